@@ -0,0 +1,103 @@
+//go:build integration
+// +build integration
+
+package storage
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// TestAzureIntegration exercises azureConfigure's Create/Read/Stat/
+// RemoveAll and its ReadDir/WalkDir support against a running
+// Azure-compatible service, e.g. Azurite started with:
+//
+//	docker run --rm -p 10000:10000 mcr.microsoft.com/azure-storage/azurite
+//
+// It's gated behind the "integration" build tag and AZURE_TEST_ACCOUNT
+// so `go test ./...` doesn't need a container to pass; run it
+// explicitly with:
+//
+//	AZURE_TEST_ENDPOINT=http://127.0.0.1:10000/devstoreaccount1 \
+//	AZURE_TEST_ACCOUNT=devstoreaccount1 \
+//	AZURE_TEST_KEY=Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw== \
+//	AZURE_TEST_CONTAINER=test-container \
+//		go test -tags integration -run TestAzureIntegration ./...
+func TestAzureIntegration(t *testing.T) {
+	account := os.Getenv("AZURE_TEST_ACCOUNT")
+	if account == "" {
+		t.Skip("AZURE_TEST_ACCOUNT not set, skipping Azurite integration test")
+	}
+	endpoint := os.Getenv("AZURE_TEST_ENDPOINT")
+	key := os.Getenv("AZURE_TEST_KEY")
+	container := os.Getenv("AZURE_TEST_CONTAINER")
+	if container == "" {
+		container = "test-container"
+	}
+
+	opts := map[string]interface{}{
+		"AzureAccountName": account,
+		"AzureAccountKey":  key,
+		"AzureContainer":   container,
+	}
+	if endpoint != "" {
+		opts["AzureEndpoint"] = endpoint
+	}
+	store, err := Init(AZURE, opts)
+	if err != nil {
+		t.Errorf("Init(AZURE, ...) failed, %s", err)
+		t.FailNow()
+	}
+
+	fname := "chunk1-7/hello.txt"
+	expected := []byte("hello from Azurite")
+	if err := store.Create(fname, bytes.NewReader(expected)); err != nil {
+		t.Errorf("Create(%q) failed, %s", fname, err)
+		t.FailNow()
+	}
+
+	data, err := store.Read(fname)
+	if err != nil {
+		t.Errorf("Read(%q) failed, %s", fname, err)
+	} else if bytes.Equal(data, expected) == false {
+		t.Errorf("Read(%q) = %q, expected %q", fname, data, expected)
+	}
+
+	if _, err := store.Stat(fname); err != nil {
+		t.Errorf("Stat(%q) failed, %s", fname, err)
+	}
+
+	entries, err := store.ReadDir("chunk1-7/")
+	if err != nil {
+		t.Errorf("ReadDir(%q) failed, %s", "chunk1-7/", err)
+	} else {
+		found := false
+		for _, info := range entries {
+			if info.Name() == "hello.txt" {
+				found = true
+			}
+		}
+		if found == false {
+			t.Errorf("ReadDir(%q) did not include %q", "chunk1-7/", fname)
+		}
+	}
+
+	walked := 0
+	if err := store.WalkDir("chunk1-7/", func(info os.FileInfo) error {
+		walked++
+		return nil
+	}); err != nil {
+		t.Errorf("WalkDir(%q) failed, %s", "chunk1-7/", err)
+	}
+	if walked == 0 {
+		t.Errorf("WalkDir(%q) visited no entries", "chunk1-7/")
+	}
+
+	if err := store.RemoveAll("chunk1-7/"); err != nil {
+		t.Errorf("RemoveAll(%q) failed, %s", "chunk1-7/", err)
+	}
+	if _, err := store.Stat(fname); err == nil {
+		t.Errorf("Stat(%q) should have failed after RemoveAll", fname)
+	}
+}
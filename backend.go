@@ -0,0 +1,319 @@
+// backend.go defines the pluggable Backend interface storage schemes
+// register themselves against, mirroring the shape of spf13/afero's Fs.
+// Store's function fields are a thin adapter over a registered Backend,
+// so third party backends can be added without editing storage.go.
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// File is the handle returned by a Backend's Create/Open/OpenFile. It is
+// trimmed down to what Store's adapter layer needs from *os.File.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Closer
+	Name() string
+	Stat() (os.FileInfo, error)
+	Readdir(count int) ([]os.FileInfo, error)
+}
+
+// Backend is the minimal filesystem-shaped interface a storage backend
+// must implement to be registered with Register.
+type Backend interface {
+	Create(name string) (File, error)
+	Open(name string) (File, error)
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Mkdir(name string, perm os.FileMode) error
+	MkdirAll(path string, perm os.FileMode) error
+	Remove(name string) error
+	RemoveAll(path string) error
+	Rename(oldname, newname string) error
+	Stat(name string) (os.FileInfo, error)
+	Name() string
+}
+
+// BackendFactory builds a Backend from the options passed to Init/GetStore.
+type BackendFactory func(opts map[string]interface{}) (Backend, error)
+
+// registry holds the schemes registered via Register, e.g. "fs", "mem".
+var registry = map[string]BackendFactory{}
+
+// Register associates scheme (without the "://") with a factory function
+// so GetStore can build a Backend for any URL using that scheme. Callers
+// add their own backends this way instead of editing Init.
+func Register(scheme string, factory BackendFactory) {
+	registry[scheme] = factory
+}
+
+// lookupBackend returns the factory registered for scheme, if any.
+func lookupBackend(scheme string) (BackendFactory, bool) {
+	factory, ok := registry[scheme]
+	return factory, ok
+}
+
+func init() {
+	Register("fs", newOsBackend)
+	Register("mem", newMemBackend)
+}
+
+// backendConfigure wires a Store's function fields to forward to backend,
+// so the resulting Store has the usual Create/Read/.../WriteFilter API
+// regardless of which Backend is behind it.
+func backendConfigure(store *Store, backend Backend) (*Store, error) {
+	store.Config["backend"] = backend
+
+	// Context-aware ops. Backend has no notion of a context, so these
+	// honor ctx best effort: they bail out early if it's already done,
+	// but (unlike fs.go's ctxFile) can't interrupt a call already in
+	// progress. That's an acceptable tradeoff here since every built-in
+	// Backend (fs, mem) completes its calls essentially instantly.
+	store.CreateContext = func(ctx context.Context, fname string, rd io.Reader) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return backendWrite(backend, fname, rd, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	}
+	store.ReadContext = func(ctx context.Context, fname string) ([]byte, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return backendRead(backend, fname)
+	}
+	store.UpdateContext = func(ctx context.Context, fname string, rd io.Reader) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return backendWrite(backend, fname, rd, os.O_WRONLY|os.O_TRUNC)
+	}
+	store.DeleteContext = func(ctx context.Context, fname string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return backend.Remove(fname)
+	}
+	store.StatContext = func(ctx context.Context, fname string) (os.FileInfo, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return backend.Stat(fname)
+	}
+	store.ReadDirContext = func(ctx context.Context, name string) ([]os.FileInfo, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		dir, err := backend.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer dir.Close()
+		return dir.Readdir(-1)
+	}
+	store.ReadFileContext = func(ctx context.Context, fname string) ([]byte, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return backendRead(backend, fname)
+	}
+	store.WriteFileContext = func(ctx context.Context, fname string, data []byte, perm os.FileMode) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return backendWrite(backend, fname, bytes.NewReader(data), os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	}
+	store.OpenContext = func(ctx context.Context, fname string) (io.ReadCloser, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return backend.Open(fname)
+	}
+	store.OpenWriteContext = func(ctx context.Context, fname string, perm os.FileMode) (io.WriteCloser, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		backend.MkdirAll(path.Dir(fname), 0775)
+		return backend.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	}
+	store.OpenRangeContext = func(ctx context.Context, fname string, off, length int64) (io.ReadCloser, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		f, err := backend.Open(fname)
+		if err != nil {
+			return nil, err
+		}
+		if off > 0 {
+			if _, err := io.CopyN(ioutil.Discard, f, off); err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
+		return rangeReadCloser{Reader: io.LimitReader(f, length), Closer: f}, nil
+	}
+
+	store.Create = func(fname string, rd io.Reader) error {
+		return store.CreateContext(context.Background(), fname, rd)
+	}
+	store.Read = func(fname string) ([]byte, error) {
+		return store.ReadContext(context.Background(), fname)
+	}
+	store.Update = func(fname string, rd io.Reader) error {
+		return store.UpdateContext(context.Background(), fname, rd)
+	}
+	store.Delete = backend.Remove
+
+	store.Stat = backend.Stat
+	store.Mkdir = backend.Mkdir
+	store.MkdirAll = backend.MkdirAll
+	store.Remove = backend.Remove
+	store.RemoveAll = backend.RemoveAll
+	store.ReadFile = func(fname string) ([]byte, error) {
+		return store.ReadFileContext(context.Background(), fname)
+	}
+	store.WriteFile = func(fname string, data []byte, perm os.FileMode) error {
+		return store.WriteFileContext(context.Background(), fname, data, perm)
+	}
+	store.ReadDir = func(name string) ([]os.FileInfo, error) {
+		return store.ReadDirContext(context.Background(), name)
+	}
+
+	// Streaming ops
+	store.Open = func(fname string) (io.ReadCloser, error) {
+		return store.OpenContext(context.Background(), fname)
+	}
+	store.OpenWrite = func(fname string, perm os.FileMode) (io.WriteCloser, error) {
+		return store.OpenWriteContext(context.Background(), fname, perm)
+	}
+	store.OpenRange = func(fname string, off, length int64) (io.ReadCloser, error) {
+		return store.OpenRangeContext(context.Background(), fname, off, length)
+	}
+
+	store.Base = path.Base
+	store.Clean = path.Clean
+	store.Dir = path.Dir
+	store.Ext = path.Ext
+	store.IsAbs = path.IsAbs
+	store.Join = path.Join
+	store.Match = path.Match
+	store.Split = path.Split
+
+	// WriteFilter runs processor against a temp file, then streams the
+	// result into the backend through OpenWrite, so finalPath is only
+	// written once processor has succeeded, the same contract as fs.go's
+	// rename based approach but backend agnostic.
+	store.WriteFilter = func(finalPath string, processor func(*os.File) error) error {
+		tmp, err := os.CreateTemp(os.TempDir(), path.Base(finalPath))
+		if err != nil {
+			return err
+		}
+		tmpName := tmp.Name()
+		defer os.Remove(tmpName)
+
+		if err := processor(tmp); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+		fp, err := os.Open(tmpName)
+		if err != nil {
+			return err
+		}
+		defer fp.Close()
+
+		wr, err := store.OpenWrite(finalPath, 0664)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(wr, fp); err != nil {
+			wr.Close()
+			return err
+		}
+		return wr.Close()
+	}
+
+	return store, nil
+}
+
+// backendWrite creates/truncates fname on backend (making parent
+// directories as needed) and copies rd into it.
+func backendWrite(backend Backend, fname string, rd io.Reader, flag int) error {
+	backend.MkdirAll(path.Dir(fname), 0775)
+	wr, err := backend.OpenFile(fname, flag, 0664)
+	if err != nil {
+		return err
+	}
+	defer wr.Close()
+	if _, err := io.Copy(wr, rd); err != nil {
+		return fmt.Errorf("%s, %s", fname, err)
+	}
+	return nil
+}
+
+// backendRead opens fname on backend and reads it in full.
+func backendRead(backend Backend, fname string) ([]byte, error) {
+	rd, err := backend.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, rd); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// osBackend implements Backend directly on top of the os package, it is
+// the Backend behind the "fs" scheme.
+type osBackend struct{}
+
+func newOsBackend(opts map[string]interface{}) (Backend, error) {
+	return &osBackend{}, nil
+}
+
+func (b *osBackend) Name() string { return "fs" }
+
+func (b *osBackend) Create(name string) (File, error) {
+	return os.Create(name)
+}
+
+func (b *osBackend) Open(name string) (File, error) {
+	return os.Open(name)
+}
+
+func (b *osBackend) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (b *osBackend) Mkdir(name string, perm os.FileMode) error {
+	return os.Mkdir(name, perm)
+}
+
+func (b *osBackend) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (b *osBackend) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (b *osBackend) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (b *osBackend) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+func (b *osBackend) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+)
+
+func TestMemBackend(t *testing.T) {
+	store, err := GetStore("mem://")
+	if err != nil {
+		t.Errorf("GetStore(%q) failed, %s", "mem://", err)
+		t.FailNow()
+	}
+
+	fname := "hello.txt"
+	helloworld := []byte(`Hello World!!!!`)
+	if err := store.Create(fname, bytes.NewReader(helloworld)); err != nil {
+		t.Errorf("Create error for %s, %s", fname, err)
+		t.FailNow()
+	}
+
+	buf, err := store.Read(fname)
+	if err != nil {
+		t.Errorf("Read error for %s, %s", fname, err)
+		t.FailNow()
+	}
+	if bytes.Compare(buf, helloworld) != 0 {
+		t.Errorf("Expected %q, got %q", helloworld, buf)
+	}
+
+	dirInfo, err := store.ReadDir(".")
+	if err != nil {
+		t.Errorf("ReadDir error, %s", err)
+		t.FailNow()
+	}
+	foundIt := false
+	for _, info := range dirInfo {
+		if info.Name() == fname {
+			foundIt = true
+		}
+	}
+	if foundIt == false {
+		t.Errorf("Expected to find %s in ReadDir results, %+v", fname, dirInfo)
+	}
+
+	if err := store.Delete(fname); err != nil {
+		t.Errorf("Delete error for %s, %s", fname, err)
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	store, err := GetStore("mem://")
+	if err != nil {
+		t.Errorf("GetStore(%q) failed, %s", "mem://", err)
+		t.FailNow()
+	}
+
+	fname := "stream.txt"
+	wr, err := store.OpenWrite(fname, 0664)
+	if err != nil {
+		t.Errorf("OpenWrite error for %s, %s", fname, err)
+		t.FailNow()
+	}
+	if _, err := wr.Write([]byte("Hello World!!!!")); err != nil {
+		t.Errorf("Write error for %s, %s", fname, err)
+		t.FailNow()
+	}
+	if err := wr.Close(); err != nil {
+		t.Errorf("Close error for %s, %s", fname, err)
+		t.FailNow()
+	}
+
+	rd, err := store.Open(fname)
+	if err != nil {
+		t.Errorf("Open error for %s, %s", fname, err)
+		t.FailNow()
+	}
+	buf, err := ioutil.ReadAll(rd)
+	rd.Close()
+	if err != nil {
+		t.Errorf("ReadAll error for %s, %s", fname, err)
+		t.FailNow()
+	}
+	if bytes.Compare(buf, []byte("Hello World!!!!")) != 0 {
+		t.Errorf("Expected %q, got %q", "Hello World!!!!", buf)
+	}
+
+	rangeRd, err := store.OpenRange(fname, 6, 5)
+	if err != nil {
+		t.Errorf("OpenRange error for %s, %s", fname, err)
+		t.FailNow()
+	}
+	rangeBuf, err := ioutil.ReadAll(rangeRd)
+	rangeRd.Close()
+	if err != nil {
+		t.Errorf("ReadAll(range) error for %s, %s", fname, err)
+		t.FailNow()
+	}
+	if bytes.Compare(rangeBuf, []byte("World")) != 0 {
+		t.Errorf("Expected %q, got %q", "World", rangeBuf)
+	}
+}
+
+func TestContext(t *testing.T) {
+	store, err := GetStore("mem://")
+	if err != nil {
+		t.Errorf("GetStore(%q) failed, %s", "mem://", err)
+		t.FailNow()
+	}
+
+	fname := "context.txt"
+	if err := store.Create(fname, bytes.NewReader([]byte("Hello World!!!!"))); err != nil {
+		t.Errorf("Create error for %s, %s", fname, err)
+		t.FailNow()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := store.CreateContext(ctx, "other.txt", bytes.NewReader([]byte("x"))); err == nil {
+		t.Errorf("expected CreateContext to fail with a cancelled context")
+	}
+	if _, err := store.ReadContext(ctx, fname); err == nil {
+		t.Errorf("expected ReadContext to fail with a cancelled context")
+	}
+	if _, err := store.OpenContext(ctx, fname); err == nil {
+		t.Errorf("expected OpenContext to fail with a cancelled context")
+	}
+
+	// The plain, non-context ops still work, since they run with
+	// context.Background() under the hood.
+	data, err := store.Read(fname)
+	if err != nil {
+		t.Errorf("Read error for %s, %s", fname, err)
+		t.FailNow()
+	}
+	if bytes.Compare(data, []byte("Hello World!!!!")) != 0 {
+		t.Errorf("Expected %q, got %q", "Hello World!!!!", data)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("greeter", func(opts map[string]interface{}) (Backend, error) {
+		return newMemBackend(opts)
+	})
+	if _, ok := lookupBackend("greeter"); ok == false {
+		t.Errorf("Expected greeter scheme to be registered")
+	}
+}
@@ -0,0 +1,246 @@
+// basepath.go adds a BasePath Store wrapper that scopes every operation
+// under a fixed prefix, analogous to afero's BasePathFs. It lets a single
+// backend (an S3 or GCS bucket, say) host several tenants by handing each
+// one a Store that can't see or touch paths outside its own prefix.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ErrOutOfBounds is returned when a path argument, once joined with the
+// wrapper's prefix and cleaned, would resolve outside of that prefix,
+// e.g. via a leading ".." or an absolute path.
+var ErrOutOfBounds = errors.New("storage: path escapes base path")
+
+// NewBasePath returns a Store that prepends prefix to every path argument
+// before delegating to store, so callers work with ordinary relative
+// paths while everything actually lands under prefix on store. ReadDir
+// and Location results are adjusted back to that same relative view.
+// Any path argument that would resolve outside of prefix is rejected
+// with ErrOutOfBounds rather than forwarded to store.
+func NewBasePath(store *Store, prefix string) *Store {
+	prefix = path.Clean(prefix)
+	wrapped := new(Store)
+	wrapped.Type = store.Type
+	wrapped.Config = map[string]interface{}{
+		"store":  store,
+		"prefix": prefix,
+	}
+
+	wrapped.CreateContext = func(ctx context.Context, fname string, rd io.Reader) error {
+		scoped, err := basePathScope(prefix, fname)
+		if err != nil {
+			return err
+		}
+		return store.CreateContext(ctx, scoped, rd)
+	}
+	wrapped.UpdateContext = func(ctx context.Context, fname string, rd io.Reader) error {
+		scoped, err := basePathScope(prefix, fname)
+		if err != nil {
+			return err
+		}
+		return store.UpdateContext(ctx, scoped, rd)
+	}
+	wrapped.ReadContext = func(ctx context.Context, fname string) ([]byte, error) {
+		scoped, err := basePathScope(prefix, fname)
+		if err != nil {
+			return nil, err
+		}
+		return store.ReadContext(ctx, scoped)
+	}
+	wrapped.DeleteContext = func(ctx context.Context, fname string) error {
+		scoped, err := basePathScope(prefix, fname)
+		if err != nil {
+			return err
+		}
+		return store.DeleteContext(ctx, scoped)
+	}
+
+	wrapped.Create = func(fname string, rd io.Reader) error {
+		return wrapped.CreateContext(context.Background(), fname, rd)
+	}
+	wrapped.Update = func(fname string, rd io.Reader) error {
+		return wrapped.UpdateContext(context.Background(), fname, rd)
+	}
+	wrapped.Read = func(fname string) ([]byte, error) {
+		return wrapped.ReadContext(context.Background(), fname)
+	}
+	wrapped.Delete = func(fname string) error {
+		return wrapped.DeleteContext(context.Background(), fname)
+	}
+
+	wrapped.StatContext = func(ctx context.Context, fname string) (os.FileInfo, error) {
+		scoped, err := basePathScope(prefix, fname)
+		if err != nil {
+			return nil, err
+		}
+		return store.StatContext(ctx, scoped)
+	}
+	wrapped.Stat = func(fname string) (os.FileInfo, error) {
+		return wrapped.StatContext(context.Background(), fname)
+	}
+	wrapped.Mkdir = func(name string, perm os.FileMode) error {
+		scoped, err := basePathScope(prefix, name)
+		if err != nil {
+			return err
+		}
+		return store.Mkdir(scoped, perm)
+	}
+	wrapped.MkdirAll = func(name string, perm os.FileMode) error {
+		scoped, err := basePathScope(prefix, name)
+		if err != nil {
+			return err
+		}
+		return store.MkdirAll(scoped, perm)
+	}
+	wrapped.Remove = func(name string) error {
+		scoped, err := basePathScope(prefix, name)
+		if err != nil {
+			return err
+		}
+		return store.Remove(scoped)
+	}
+	wrapped.RemoveAll = func(name string) error {
+		scoped, err := basePathScope(prefix, name)
+		if err != nil {
+			return err
+		}
+		return store.RemoveAll(scoped)
+	}
+	wrapped.ReadFileContext = func(ctx context.Context, fname string) ([]byte, error) {
+		scoped, err := basePathScope(prefix, fname)
+		if err != nil {
+			return nil, err
+		}
+		return store.ReadFileContext(ctx, scoped)
+	}
+	wrapped.WriteFileContext = func(ctx context.Context, fname string, data []byte, perm os.FileMode) error {
+		scoped, err := basePathScope(prefix, fname)
+		if err != nil {
+			return err
+		}
+		return store.WriteFileContext(ctx, scoped, data, perm)
+	}
+	wrapped.ReadFile = func(fname string) ([]byte, error) {
+		return wrapped.ReadFileContext(context.Background(), fname)
+	}
+	wrapped.WriteFile = func(fname string, data []byte, perm os.FileMode) error {
+		return wrapped.WriteFileContext(context.Background(), fname, data, perm)
+	}
+
+	wrapped.ReadDirContext = func(ctx context.Context, name string) ([]os.FileInfo, error) {
+		scoped, err := basePathScope(prefix, name)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := store.ReadDirContext(ctx, scoped)
+		if err != nil {
+			return nil, err
+		}
+		infos := make([]os.FileInfo, len(entries))
+		for i, info := range entries {
+			infos[i] = basePathFileInfo{
+				FileInfo: info,
+				name:     strings.TrimPrefix(info.Name(), prefix+"/"),
+			}
+		}
+		return infos, nil
+	}
+	wrapped.ReadDir = func(name string) ([]os.FileInfo, error) {
+		return wrapped.ReadDirContext(context.Background(), name)
+	}
+
+	wrapped.WriteFilter = func(finalPath string, processor func(*os.File) error) error {
+		scoped, err := basePathScope(prefix, finalPath)
+		if err != nil {
+			return err
+		}
+		return store.WriteFilter(scoped, processor)
+	}
+
+	wrapped.OpenContext = func(ctx context.Context, fname string) (io.ReadCloser, error) {
+		scoped, err := basePathScope(prefix, fname)
+		if err != nil {
+			return nil, err
+		}
+		return store.OpenContext(ctx, scoped)
+	}
+	wrapped.OpenWriteContext = func(ctx context.Context, fname string, perm os.FileMode) (io.WriteCloser, error) {
+		scoped, err := basePathScope(prefix, fname)
+		if err != nil {
+			return nil, err
+		}
+		return store.OpenWriteContext(ctx, scoped, perm)
+	}
+	wrapped.OpenRangeContext = func(ctx context.Context, fname string, off, length int64) (io.ReadCloser, error) {
+		scoped, err := basePathScope(prefix, fname)
+		if err != nil {
+			return nil, err
+		}
+		return store.OpenRangeContext(ctx, scoped, off, length)
+	}
+	wrapped.Open = func(fname string) (io.ReadCloser, error) {
+		return wrapped.OpenContext(context.Background(), fname)
+	}
+	wrapped.OpenWrite = func(fname string, perm os.FileMode) (io.WriteCloser, error) {
+		return wrapped.OpenWriteContext(context.Background(), fname, perm)
+	}
+	wrapped.OpenRange = func(fname string, off, length int64) (io.ReadCloser, error) {
+		return wrapped.OpenRangeContext(context.Background(), fname, off, length)
+	}
+
+	wrapped.LocationFn = func(workPath string) (string, error) {
+		scoped, err := basePathScope(prefix, workPath)
+		if err != nil {
+			return "", err
+		}
+		loc, err := store.Location(scoped)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimPrefix(loc, prefix+"/"), nil
+	}
+
+	// Path helpers operate on names rather than files and aren't
+	// prefix relative, so they pass straight through, same as overlay.go.
+	wrapped.Base = store.Base
+	wrapped.Clean = store.Clean
+	wrapped.Dir = store.Dir
+	wrapped.Ext = store.Ext
+	wrapped.IsAbs = store.IsAbs
+	wrapped.Join = store.Join
+	wrapped.Match = store.Match
+	wrapped.Split = store.Split
+
+	return wrapped
+}
+
+// basePathScope joins name onto prefix and validates that the cleaned
+// result still lives under prefix, rejecting absolute paths and any
+// ".." that would otherwise escape it.
+func basePathScope(prefix, name string) (string, error) {
+	if path.IsAbs(name) {
+		return "", ErrOutOfBounds
+	}
+	joined := path.Clean(path.Join(prefix, name))
+	if joined != prefix && strings.HasPrefix(joined, prefix+"/") == false {
+		return "", ErrOutOfBounds
+	}
+	return joined, nil
+}
+
+// basePathFileInfo wraps an os.FileInfo so Name() reports the entry's
+// name relative to a BasePath wrapper's prefix instead of the underlying
+// store's full, prefixed path.
+type basePathFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (fi basePathFileInfo) Name() string { return fi.name }
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestBasePath(t *testing.T) {
+	base, err := GetStore("mem://")
+	if err != nil {
+		t.Errorf("GetStore(mem://) failed, %s", err)
+		t.FailNow()
+	}
+
+	store := NewBasePath(base, "tenants/acme")
+
+	if err := store.Create("hello.txt", bytes.NewReader([]byte("hi"))); err != nil {
+		t.Errorf("Create(hello.txt) failed, %s", err)
+		t.FailNow()
+	}
+
+	// The file actually lands under the prefix on the underlying store...
+	if _, err := base.Stat("tenants/acme/hello.txt"); err != nil {
+		t.Errorf("expected base to have tenants/acme/hello.txt, %s", err)
+	}
+
+	// ...but the wrapper sees it under its own bare name.
+	data, err := store.Read("hello.txt")
+	if err != nil {
+		t.Errorf("Read(hello.txt) failed, %s", err)
+		t.FailNow()
+	}
+	if bytes.Compare(data, []byte("hi")) != 0 {
+		t.Errorf("expected %q, got %q", "hi", data)
+	}
+
+	// Path traversal attempts are rejected rather than forwarded.
+	if _, err := store.Read("../escape.txt"); err != ErrOutOfBounds {
+		t.Errorf("expected ErrOutOfBounds for ../escape.txt, got %v", err)
+	}
+	if _, err := store.Read("/etc/passwd"); err != ErrOutOfBounds {
+		t.Errorf("expected ErrOutOfBounds for /etc/passwd, got %v", err)
+	}
+	if err := store.Create("../../escape.txt", bytes.NewReader([]byte("x"))); err != ErrOutOfBounds {
+		t.Errorf("expected ErrOutOfBounds for ../../escape.txt, got %v", err)
+	}
+	if _, err := base.Stat("escape.txt"); err == nil {
+		t.Errorf("expected traversal attempt to not reach base")
+	}
+
+	// ReadDir lists the scoped directory and reports bare names.
+	dirInfo, err := store.ReadDir(".")
+	if err != nil {
+		t.Errorf("ReadDir failed, %s", err)
+		t.FailNow()
+	}
+	found := false
+	for _, info := range dirInfo {
+		if info.Name() == "hello.txt" {
+			found = true
+		}
+	}
+	if found == false {
+		t.Errorf("expected hello.txt in ReadDir results, got %+v", dirInfo)
+	}
+
+	// Location strips the prefix back off.
+	loc, err := store.Location("hello.txt")
+	if err != nil {
+		t.Errorf("Location(hello.txt) failed, %s", err)
+		t.FailNow()
+	}
+	if loc != "hello.txt" {
+		t.Errorf("expected Location to strip prefix, got %q", loc)
+	}
+
+	// Streaming ops are scoped under the prefix too.
+	if _, err := store.Open("/etc/passwd"); err != ErrOutOfBounds {
+		t.Errorf("expected ErrOutOfBounds for /etc/passwd, got %v", err)
+	}
+	rd, err := store.Open("hello.txt")
+	if err != nil {
+		t.Errorf("Open(hello.txt) failed, %s", err)
+		t.FailNow()
+	}
+	streamed, err := ioutil.ReadAll(rd)
+	rd.Close()
+	if err != nil {
+		t.Errorf("ReadAll(hello.txt) failed, %s", err)
+		t.FailNow()
+	}
+	if bytes.Compare(streamed, []byte("hi")) != 0 {
+		t.Errorf("expected %q, got %q", "hi", streamed)
+	}
+
+	// Path helpers pass straight through, unaware of the prefix.
+	if store.IsAbs("/abs") == false {
+		t.Errorf("expected IsAbs(/abs) true")
+	}
+	if got := store.Join("a", "b"); got != "a/b" {
+		t.Errorf("expected Join(a, b) = a/b, got %q", got)
+	}
+	dir, file := store.Split("a/b")
+	if dir != "a/" || file != "b" {
+		t.Errorf("expected Split(a/b) = (a/, b), got (%q, %q)", dir, file)
+	}
+}
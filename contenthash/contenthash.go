@@ -0,0 +1,186 @@
+//
+// Package contenthash computes stable content digests over a
+// storage.Store so callers can detect changes, dedup uploads, and build
+// cache keys, the same problem BuildKit's contenthash package solves for
+// a build graph.
+//
+package contenthash
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"os"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/caltechlibrary/storage"
+)
+
+// cache memoizes digests for one Store, keyed by cleaned absolute path.
+// A directory gets two entries: key+"/" holds the digest of just that
+// directory's own header record as its parent sees it, and key (no
+// trailing slash) holds the full recursive digest a caller actually
+// wants back. Keeping them separate lets Notify invalidate only what a
+// write could have changed: touching a path invalidates its own entries
+// plus the recursive entry of every ancestor, but never an ancestor's
+// header entry, since a directory's header never depends on what's
+// inside it.
+type cache struct {
+	mu      sync.Mutex
+	digests map[string]string
+}
+
+// caches holds one cache per Store seen so far, so two different Stores
+// (say a src and a dst in Sync) never collide on the same path string.
+var caches sync.Map // map[*storage.Store]*cache
+
+func cacheFor(store *storage.Store) *cache {
+	v, _ := caches.LoadOrStore(store, &cache{digests: map[string]string{}})
+	return v.(*cache)
+}
+
+func (c *cache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	digest, ok := c.digests[key]
+	return digest, ok
+}
+
+func (c *cache) set(key, digest string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.digests[key] = digest
+}
+
+// Notify invalidates any digest cached for store that a write to p could
+// have changed: p's own header and contents entries, plus the recursive
+// (no trailing slash) entry of every ancestor directory up to "/". It's
+// the hook Create/Update/Delete/WriteFile call on a Store wrapped with
+// WrapStore, so callers don't have to remember to invalidate by hand.
+func Notify(store *storage.Store, p string) {
+	cacheFor(store).notify(p)
+}
+
+func (c *cache) notify(p string) {
+	clean := cleanPath(p)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.digests, clean)
+	delete(c.digests, clean+"/")
+	for clean != "/" {
+		clean = path.Dir(clean)
+		delete(c.digests, clean)
+	}
+}
+
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// Checksum returns a stable "sha256:<hex>" digest for p on store: the
+// sha256 of the file's bytes if p is a file, or a canonical recursive
+// digest over a sorted directory listing if p is a directory (see
+// checksumDir). Results are memoized per Store and survive until
+// Notify/WrapStore invalidates them.
+func Checksum(store *storage.Store, p string) (string, error) {
+	c := cacheFor(store)
+	key := cleanPath(p)
+
+	info, err := store.Stat(p)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return c.checksumDir(store, p, key)
+	}
+	return c.checksumFile(store, p, key)
+}
+
+func (c *cache) checksumFile(store *storage.Store, p, key string) (string, error) {
+	if digest, ok := c.get(key); ok {
+		return digest, nil
+	}
+	data, err := store.Read(p)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := h.Write(data); err != nil {
+		return "", err
+	}
+	digest := sumToDigest(h)
+	c.set(key, digest)
+	return digest, nil
+}
+
+// checksumDir hashes a canonical record per sorted entry of p:
+// "mode\x00name\x00content\n", where content is a file's own digest, a
+// subdirectory's recursive digest, or (matching containerd semantics) a
+// symlink's resolved target string rather than target contents.
+func (c *cache) checksumDir(store *storage.Store, p, key string) (string, error) {
+	if digest, ok := c.get(key); ok {
+		return digest, nil
+	}
+	entries, err := store.ReadDir(p)
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	h := sha256.New()
+	for _, entry := range entries {
+		childPath := path.Join(p, entry.Name())
+		childKey := path.Join(key, entry.Name())
+
+		var content string
+		switch {
+		case entry.Mode()&os.ModeSymlink != 0 && store.Type == storage.FS:
+			target, err := symlinkTarget(store, childPath)
+			if err != nil {
+				return "", err
+			}
+			content = target
+		case entry.IsDir():
+			digest, err := c.checksumDir(store, childPath, childKey)
+			if err != nil {
+				return "", err
+			}
+			content = digest
+		default:
+			digest, err := c.checksumFile(store, childPath, childKey)
+			if err != nil {
+				return "", err
+			}
+			content = digest
+		}
+		fmt.Fprintf(h, "%o\x00%s\x00%s\n", entry.Mode(), entry.Name(), content)
+	}
+
+	digest := sumToDigest(h)
+	c.set(key, digest)
+	// The header entry is currently identical to the recursive one,
+	// since Store exposes no directory metadata beyond its own listing.
+	// It's kept as a separate cache key anyway so Notify can leave it
+	// alone once that stops being true.
+	c.set(key+"/", digest)
+	return digest, nil
+}
+
+// symlinkTarget resolves name's symlink target via the local os package.
+// Only called when store.Type == storage.FS, since that's the only
+// backend in this package that models symlinks at all; other backends
+// hash a symlink like a regular file instead.
+func symlinkTarget(store *storage.Store, name string) (string, error) {
+	loc, err := store.Location(name)
+	if err != nil {
+		return "", err
+	}
+	return os.Readlink(loc)
+}
+
+func sumToDigest(h hash.Hash) string {
+	return fmt.Sprintf("sha256:%s", hex.EncodeToString(h.Sum(nil)))
+}
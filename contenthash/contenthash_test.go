@@ -0,0 +1,105 @@
+package contenthash
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/caltechlibrary/storage"
+)
+
+func TestChecksumFile(t *testing.T) {
+	base, err := storage.GetStore("mem://")
+	if err != nil {
+		t.Errorf("GetStore(mem://) failed, %s", err)
+		t.FailNow()
+	}
+	store := WrapStore(base)
+
+	if err := store.Create("hello.txt", bytes.NewReader([]byte("hello"))); err != nil {
+		t.Errorf("Create(hello.txt) failed, %s", err)
+		t.FailNow()
+	}
+
+	digest, err := Checksum(store, "hello.txt")
+	if err != nil {
+		t.Errorf("Checksum(hello.txt) failed, %s", err)
+		t.FailNow()
+	}
+	if digest != "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("unexpected digest for %q: %s", "hello", digest)
+	}
+
+	// Same content comes back cached and stable.
+	again, err := Checksum(store, "hello.txt")
+	if err != nil {
+		t.Errorf("second Checksum(hello.txt) failed, %s", err)
+		t.FailNow()
+	}
+	if again != digest {
+		t.Errorf("expected cached digest to match, got %q, want %q", again, digest)
+	}
+
+	// A write through the wrapped Store invalidates the cache.
+	if err := store.Update("hello.txt", bytes.NewReader([]byte("goodbye"))); err != nil {
+		t.Errorf("Update(hello.txt) failed, %s", err)
+		t.FailNow()
+	}
+	changed, err := Checksum(store, "hello.txt")
+	if err != nil {
+		t.Errorf("Checksum(hello.txt) after Update failed, %s", err)
+		t.FailNow()
+	}
+	if changed == digest {
+		t.Errorf("expected digest to change after Update, still got %s", changed)
+	}
+}
+
+func TestChecksumDirAndSync(t *testing.T) {
+	src, err := storage.GetStore("mem://")
+	if err != nil {
+		t.Errorf("GetStore(src) failed, %s", err)
+		t.FailNow()
+	}
+	dst, err := storage.GetStore("mem://")
+	if err != nil {
+		t.Errorf("GetStore(dst) failed, %s", err)
+		t.FailNow()
+	}
+
+	if err := src.Create("dir/a.txt", bytes.NewReader([]byte("a"))); err != nil {
+		t.Errorf("Create(dir/a.txt) failed, %s", err)
+		t.FailNow()
+	}
+	if err := src.Create("dir/b.txt", bytes.NewReader([]byte("b"))); err != nil {
+		t.Errorf("Create(dir/b.txt) failed, %s", err)
+		t.FailNow()
+	}
+
+	if err := Sync(dst, src, "dir", "dir"); err != nil {
+		t.Errorf("Sync failed, %s", err)
+		t.FailNow()
+	}
+
+	data, err := dst.Read("dir/a.txt")
+	if err != nil {
+		t.Errorf("dst.Read(dir/a.txt) failed, %s", err)
+		t.FailNow()
+	}
+	if bytes.Compare(data, []byte("a")) != 0 {
+		t.Errorf("expected %q, got %q", "a", data)
+	}
+
+	srcDigest, err := Checksum(src, "dir")
+	if err != nil {
+		t.Errorf("Checksum(src, dir) failed, %s", err)
+		t.FailNow()
+	}
+	dstDigest, err := Checksum(dst, "dir")
+	if err != nil {
+		t.Errorf("Checksum(dst, dir) failed, %s", err)
+		t.FailNow()
+	}
+	if srcDigest != dstDigest {
+		t.Errorf("expected matching directory digests after Sync, got %s and %s", srcDigest, dstDigest)
+	}
+}
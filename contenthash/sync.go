@@ -0,0 +1,58 @@
+package contenthash
+
+import (
+	"path"
+
+	"github.com/caltechlibrary/storage"
+)
+
+// Sync copies srcPath on srcStore to dstPath on dstStore, recursing into
+// directories and skipping any file whose Checksum on dstStore already
+// matches srcStore's, so re-running Sync against an already-mirrored
+// tree is cheap. It's meant for mirroring a tree between two Stores of
+// different types (FS -> S3, say) without re-uploading unchanged files.
+func Sync(dstStore, srcStore *storage.Store, srcPath, dstPath string) error {
+	info, err := srcStore.Stat(srcPath)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return syncDir(dstStore, srcStore, srcPath, dstPath)
+	}
+	return syncFile(dstStore, srcStore, srcPath, dstPath)
+}
+
+func syncFile(dstStore, srcStore *storage.Store, srcPath, dstPath string) error {
+	srcDigest, err := Checksum(srcStore, srcPath)
+	if err != nil {
+		return err
+	}
+	if dstDigest, err := Checksum(dstStore, dstPath); err == nil && dstDigest == srcDigest {
+		return nil
+	}
+
+	data, err := srcStore.Read(srcPath)
+	if err != nil {
+		return err
+	}
+	if err := dstStore.WriteFile(dstPath, data, 0664); err != nil {
+		return err
+	}
+	Notify(dstStore, dstPath)
+	return nil
+}
+
+func syncDir(dstStore, srcStore *storage.Store, srcPath, dstPath string) error {
+	entries, err := srcStore.ReadDir(srcPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		childSrc := path.Join(srcPath, entry.Name())
+		childDst := path.Join(dstPath, entry.Name())
+		if err := Sync(dstStore, srcStore, childSrc, childDst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package contenthash
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/caltechlibrary/storage"
+)
+
+// WrapStore returns a Store identical to store except that its
+// Create/Update/Delete/WriteFile (and their Context counterparts) call
+// Notify after a successful write, so cached Checksum results for store
+// never go stale. It follows the same composition pattern as
+// storage.NewOverlay/NewBasePath: callers should do all reading and
+// writing through the returned Store, the same one they pass to
+// Checksum and Sync.
+func WrapStore(store *storage.Store) *storage.Store {
+	wrapped := new(storage.Store)
+	*wrapped = *store
+
+	wrapped.CreateContext = func(ctx context.Context, fname string, rd io.Reader) error {
+		if err := store.CreateContext(ctx, fname, rd); err != nil {
+			return err
+		}
+		Notify(wrapped, fname)
+		return nil
+	}
+	wrapped.UpdateContext = func(ctx context.Context, fname string, rd io.Reader) error {
+		if err := store.UpdateContext(ctx, fname, rd); err != nil {
+			return err
+		}
+		Notify(wrapped, fname)
+		return nil
+	}
+	wrapped.DeleteContext = func(ctx context.Context, fname string) error {
+		if err := store.DeleteContext(ctx, fname); err != nil {
+			return err
+		}
+		Notify(wrapped, fname)
+		return nil
+	}
+	wrapped.WriteFileContext = func(ctx context.Context, fname string, data []byte, perm os.FileMode) error {
+		if err := store.WriteFileContext(ctx, fname, data, perm); err != nil {
+			return err
+		}
+		Notify(wrapped, fname)
+		return nil
+	}
+
+	wrapped.Create = func(fname string, rd io.Reader) error {
+		return wrapped.CreateContext(context.Background(), fname, rd)
+	}
+	wrapped.Update = func(fname string, rd io.Reader) error {
+		return wrapped.UpdateContext(context.Background(), fname, rd)
+	}
+	wrapped.Delete = func(fname string) error {
+		return wrapped.DeleteContext(context.Background(), fname)
+	}
+	wrapped.WriteFile = func(fname string, data []byte, perm os.FileMode) error {
+		return wrapped.WriteFileContext(context.Background(), fname, data, perm)
+	}
+
+	return wrapped
+}
@@ -1,9 +1,8 @@
-//
 // fs.go defines local file system support for storage.go
-//
 package storage
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -15,23 +14,95 @@ import (
 func fsConfigure(store *Store) (*Store, error) {
 	store.Type = FS
 
+	// Context-aware ops. These do the real work; the plain ops below
+	// wrap them with context.Background() for backward compatibility.
+	store.CreateContext = func(ctx context.Context, fname string, rd io.Reader) error {
+		return fsCreate(ctx, fname, rd)
+	}
+	store.ReadContext = func(ctx context.Context, fname string) ([]byte, error) {
+		return fsRead(ctx, fname)
+	}
+	store.UpdateContext = func(ctx context.Context, fname string, rd io.Reader) error {
+		return fsUpdate(ctx, fname, rd)
+	}
+	store.DeleteContext = func(ctx context.Context, fname string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return os.Remove(fname)
+	}
+	store.StatContext = func(ctx context.Context, fname string) (os.FileInfo, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return os.Stat(fname)
+	}
+	store.ReadDirContext = func(ctx context.Context, name string) ([]os.FileInfo, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return ioutil.ReadDir(name)
+	}
+	store.ReadFileContext = func(ctx context.Context, fname string) ([]byte, error) {
+		return fsRead(ctx, fname)
+	}
+	store.WriteFileContext = func(ctx context.Context, fname string, data []byte, perm os.FileMode) error {
+		return fsWriteFile(ctx, fname, data, perm)
+	}
+	store.OpenContext = func(ctx context.Context, fname string) (io.ReadCloser, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		fp, err := os.Open(fname)
+		if err != nil {
+			return nil, err
+		}
+		return newCtxFile(ctx, fp), nil
+	}
+	store.OpenWriteContext = func(ctx context.Context, fname string, perm os.FileMode) (io.WriteCloser, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		os.MkdirAll(path.Dir(fname), 0775)
+		fp, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+		if err != nil {
+			return nil, err
+		}
+		return newCtxFile(ctx, fp), nil
+	}
+	store.OpenRangeContext = func(ctx context.Context, fname string, off, length int64) (io.ReadCloser, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		fp, err := os.Open(fname)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fp.Seek(off, io.SeekStart); err != nil {
+			fp.Close()
+			return nil, err
+		}
+		cf := newCtxFile(ctx, fp)
+		return rangeReadCloser{Reader: io.LimitReader(cf, length), Closer: cf}, nil
+	}
+
 	// Basic CRUD ops
 	store.Create = func(fname string, rd io.Reader) error {
-		return fsCreate(store, fname, rd)
+		return store.CreateContext(context.Background(), fname, rd)
 	}
 	store.Read = func(fname string) ([]byte, error) {
-		return ioutil.ReadFile(fname)
+		return store.ReadContext(context.Background(), fname)
 	}
 	store.Update = func(fname string, rd io.Reader) error {
-		return fsUpdate(store, fname, rd)
+		return store.UpdateContext(context.Background(), fname, rd)
 	}
 	store.Delete = func(fname string) error {
-		return os.Remove(fname)
+		return store.DeleteContext(context.Background(), fname)
 	}
 
 	// Extra ops for compatibility with os.* and ioutil.*
 	store.Stat = func(fname string) (os.FileInfo, error) {
-		return os.Stat(fname)
+		return store.StatContext(context.Background(), fname)
 	}
 	store.Mkdir = func(name string, perm os.FileMode) error {
 		return os.Mkdir(name, perm)
@@ -46,10 +117,24 @@ func fsConfigure(store *Store) (*Store, error) {
 		return os.RemoveAll(path)
 	}
 	store.ReadFile = func(fname string) ([]byte, error) {
-		return ioutil.ReadFile(fname)
+		return store.ReadFileContext(context.Background(), fname)
 	}
 	store.WriteFile = func(fname string, data []byte, perm os.FileMode) error {
-		return ioutil.WriteFile(fname, data, perm)
+		return store.WriteFileContext(context.Background(), fname, data, perm)
+	}
+	store.ReadDir = func(name string) ([]os.FileInfo, error) {
+		return store.ReadDirContext(context.Background(), name)
+	}
+
+	// Streaming ops
+	store.Open = func(fname string) (io.ReadCloser, error) {
+		return store.OpenContext(context.Background(), fname)
+	}
+	store.OpenWrite = func(fname string, perm os.FileMode) (io.WriteCloser, error) {
+		return store.OpenWriteContext(context.Background(), fname, perm)
+	}
+	store.OpenRange = func(fname string, off, length int64) (io.ReadCloser, error) {
+		return store.OpenRangeContext(context.Background(), fname, off, length)
 	}
 
 	// Extended ops for datatools and dataset
@@ -99,8 +184,39 @@ func fsConfigure(store *Store) (*Store, error) {
 	return store, nil
 }
 
-// fsCreate creates a new file on the file system with a given name from the byte array.
-func fsCreate(s *Store, fname string, rd io.Reader) error {
+// ctxFile wraps an *os.File with a background watcher that closes the
+// file if ctx is cancelled before Close is called the normal way, since
+// os.File has no native way to accept a context. This is best effort
+// only: a Read/Write already blocked in the kernel may not unblock until
+// the next syscall boundary.
+type ctxFile struct {
+	*os.File
+	stop func()
+}
+
+func newCtxFile(ctx context.Context, f *os.File) *ctxFile {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			f.Close()
+		case <-done:
+		}
+	}()
+	return &ctxFile{File: f, stop: func() { close(done) }}
+}
+
+func (f *ctxFile) Close() error {
+	f.stop()
+	return f.File.Close()
+}
+
+// fsCreate creates a new file on the file system with a given name from
+// rd's content, honoring ctx best effort (see ctxFile).
+func fsCreate(ctx context.Context, fname string, rd io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	// FIXME: FSCreate should create the path elements only if necessary
 	dname := path.Dir(fname)
 	os.MkdirAll(dname, 0775)
@@ -108,25 +224,78 @@ func fsCreate(s *Store, fname string, rd io.Reader) error {
 	if err != nil {
 		return err
 	}
-	defer wr.Close()
-	_, err = io.Copy(wr, rd)
+	cf := newCtxFile(ctx, wr)
+	defer cf.Close()
+	_, err = io.Copy(cf, rd)
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
 		return fmt.Errorf("%s, %s", fname, err)
 	}
 	return nil
 }
 
-// fsUpdate replaces a file on the file system with the contents fo byte array returning error.
-// It will truncate the file if necessary.
-func fsUpdate(s *Store, fname string, rd io.Reader) error {
+// fsUpdate replaces a file on the file system with rd's content,
+// truncating it if necessary, and honors ctx best effort (see ctxFile).
+func fsUpdate(ctx context.Context, fname string, rd io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	wr, err := os.OpenFile(fname, os.O_RDWR|os.O_TRUNC, 0664)
 	if err != nil {
 		return err
 	}
-	defer wr.Close()
-	_, err = io.Copy(wr, rd)
+	cf := newCtxFile(ctx, wr)
+	defer cf.Close()
+	_, err = io.Copy(cf, rd)
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
 		return fmt.Errorf("%s, %s", fname, err)
 	}
 	return nil
 }
+
+// fsRead reads fname in full, honoring ctx best effort (see ctxFile).
+func fsRead(ctx context.Context, fname string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fp, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	cf := newCtxFile(ctx, fp)
+	defer cf.Close()
+	data, err := ioutil.ReadAll(cf)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// fsWriteFile writes data to fname in full, honoring ctx best effort
+// (see ctxFile).
+func fsWriteFile(ctx context.Context, fname string, data []byte, perm os.FileMode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	wr, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	cf := newCtxFile(ctx, wr)
+	defer cf.Close()
+	if _, err := cf.Write(data); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return err
+	}
+	return nil
+}
@@ -1,104 +1,426 @@
-//
 // gocdk.go wraps Go Cloud Development Kit's blob package for use
 // with our storage module.  It will allow us to drop individual wrappers
 // e.g. fs.go, s3.go, gs.go while also picking up support for in-memory
 // and Azure based blob storage.
 //
 // For docs see https://godoc.org/gocloud.dev/blob
-//
 package storage
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path"
+	"strings"
+	"time"
 
 	// Go Cloud Development Kit
 	"gocloud.dev/blob"
+
+	// Blank imports register the scheme specific URL openers with blob.OpenBucket
+	_ "gocloud.dev/blob/azureblob"
+	_ "gocloud.dev/blob/fileblob"
+	_ "gocloud.dev/blob/gcsblob"
+	_ "gocloud.dev/blob/memblob"
+	_ "gocloud.dev/blob/s3blob"
 )
 
-// cdkConfigure initialize a store to a local disc system type
+// cdkObjectInfo adapts a blob.ListObject to os.FileInfo so ReadDir results
+// look like any other Store's.
+type cdkObjectInfo struct {
+	obj *blob.ListObject
+}
+
+func (d *cdkObjectInfo) Name() string {
+	return path.Base(strings.TrimSuffix(d.obj.Key, "/"))
+}
+
+func (d *cdkObjectInfo) Size() int64 {
+	return d.obj.Size
+}
+
+func (d *cdkObjectInfo) ModTime() time.Time {
+	return d.obj.ModTime
+}
+
+// Mode returns a directory mode for "directory" entries synthesized by
+// the delimited listing, zero otherwise since blob stores don't model
+// POSIX permissions.
+func (d *cdkObjectInfo) Mode() os.FileMode {
+	if d.obj.IsDir {
+		return os.ModeDir
+	}
+	return os.FileMode(0)
+}
+
+// IsDir returns true for the pseudo-directory entries blob.ListOptions
+// synthesizes when a Delimiter is set.
+func (d *cdkObjectInfo) IsDir() bool {
+	return d.obj.IsDir
+}
+
+func (d *cdkObjectInfo) Sys() interface{} {
+	return d.obj
+}
+
+// cdkBucketURL builds the URL passed to blob.OpenBucket from store.Config,
+// letting callers provide either a ready made "CDKBucketURL" or the
+// individual pieces: "CDKScheme" and "CDKBucket" are joined into
+// "<scheme>://<bucket>", with "CDKRegion", "CDKEndpoint", and
+// "CDKCredentialsFile" appended as the "region", "endpoint", and
+// "credentials_file" query parameters the scheme-specific gocloud.dev URL
+// opener (s3blob, gcsblob, azureblob, ...) reads, so callers aren't forced
+// to depend on AWS_*/GOOGLE_*-style environment variables.
+func cdkBucketURL(store *Store) (string, error) {
+	if val, ok := store.Config["CDKBucketURL"]; ok == true {
+		return val.(string), nil
+	}
+	scheme, ok := store.Config["CDKScheme"]
+	if ok == false {
+		return "", fmt.Errorf("CDKBucketURL not configured")
+	}
+	bucket, ok := store.Config["CDKBucket"]
+	if ok == false {
+		return "", fmt.Errorf("CDKBucket not configured")
+	}
+	u := url.URL{Scheme: scheme.(string), Host: bucket.(string)}
+	q := u.Query()
+	if val, ok := store.Config["CDKRegion"]; ok == true {
+		q.Set("region", val.(string))
+	}
+	if val, ok := store.Config["CDKEndpoint"]; ok == true {
+		q.Set("endpoint", val.(string))
+	}
+	if val, ok := store.Config["CDKCredentialsFile"]; ok == true {
+		q.Set("credentials_file", val.(string))
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// cdkConfigure initializes a store backed by gocloud.dev/blob. The bucket
+// is selected entirely by the URL scheme of CDKBucketURL (s3://, gs://,
+// azblob://, mem://, file://), so one Store implementation covers all of
+// them.
 func cdkConfigure(store *Store) (*Store, error) {
 	store.Type = GO_CDK
 
+	bucketURL, err := cdkBucketURL(store)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	bucket, err := blob.OpenBucket(ctx, bucketURL)
+	if err != nil {
+		return nil, fmt.Errorf("blob.OpenBucket(%q), %s", bucketURL, err)
+	}
+	store.Config["cdkBucket"] = bucket
+
+	// Context-aware ops. These do the real work, threading ctx straight
+	// into the underlying bucket call, so a caller's cancellation/timeout
+	// actually aborts the in-flight SDK request instead of just the local
+	// wait. The plain ops below wrap them with context.Background().
+	store.CreateContext = func(ctx context.Context, fname string, rd io.Reader) error {
+		return cdkCreate(ctx, store, fname, rd)
+	}
+	store.ReadContext = func(ctx context.Context, fname string) ([]byte, error) {
+		return cdkRead(ctx, store, fname)
+	}
+	store.UpdateContext = func(ctx context.Context, fname string, rd io.Reader) error {
+		// NOTE: blob.Bucket has no distinct update, writing a key overwrites it.
+		return cdkCreate(ctx, store, fname, rd)
+	}
+	store.DeleteContext = func(ctx context.Context, fname string) error {
+		return cdkRemove(ctx, store, fname)
+	}
+	store.StatContext = func(ctx context.Context, fname string) (os.FileInfo, error) {
+		return cdkStat(ctx, store, fname)
+	}
+	store.ReadDirContext = func(ctx context.Context, prefix string) ([]os.FileInfo, error) {
+		return cdkReadDir(ctx, store, prefix)
+	}
+	store.ReadFileContext = func(ctx context.Context, fname string) ([]byte, error) {
+		return cdkRead(ctx, store, fname)
+	}
+	store.WriteFileContext = func(ctx context.Context, fname string, data []byte, perm os.FileMode) error {
+		return cdkCreate(ctx, store, fname, bytes.NewReader(data))
+	}
+	store.OpenContext = func(ctx context.Context, fname string) (io.ReadCloser, error) {
+		return cdkOpen(ctx, store, fname)
+	}
+	store.OpenWriteContext = func(ctx context.Context, fname string, perm os.FileMode) (io.WriteCloser, error) {
+		return cdkOpenWrite(ctx, store, fname)
+	}
+	store.OpenRangeContext = func(ctx context.Context, fname string, off, length int64) (io.ReadCloser, error) {
+		return cdkOpenRange(ctx, store, fname, off, length)
+	}
+
 	// Basic CRUD ops
 	store.Create = func(fname string, rd io.Reader) error {
-		return fmt.Errorf("store.Create() not implemented")
+		return store.CreateContext(context.Background(), fname, rd)
 	}
 	store.Read = func(fname string) ([]byte, error) {
-		return fmt.Errorf("store.Read() not implemented")
+		return store.ReadContext(context.Background(), fname)
 	}
 	store.Update = func(fname string, rd io.Reader) error {
-		return fmt.Errorf("store.Update() not implemented")
+		return store.UpdateContext(context.Background(), fname, rd)
 	}
 	store.Delete = func(fname string) error {
-		return fmt.Errorf("store.Delete() not implemented")
+		return store.DeleteContext(context.Background(), fname)
 	}
 
 	// Extra ops for compatibility with os.* and ioutil.*
 	store.Stat = func(fname string) (os.FileInfo, error) {
-		return nil, fmt.Errorf("store.Stat() not implemented")
+		return store.StatContext(context.Background(), fname)
 	}
 	store.Mkdir = func(name string, perm os.FileMode) error {
-		return fmt.Errorf("store.Mkdir() not implemented")
+		//NOTE: blob stores lack the concept of directories, keys imply them.
+		return nil
 	}
 	store.MkdirAll = func(path string, perm os.FileMode) error {
-		return fmt.Errorf("store.MkdirAll() not implemented")
+		//NOTE: blob stores lack the concept of directories, keys imply them.
+		return nil
 	}
 	store.Remove = func(name string) error {
-		return fmt.Errorf("store.Remove() not implemented")
+		return store.DeleteContext(context.Background(), name)
 	}
-	store.RemoveAll = func(path string) error {
-		return fmt.Errorf("store.RemoveAll() not implemented")
+	store.RemoveAll = func(prefixName string) error {
+		return cdkRemoveAll(context.Background(), store, prefixName)
 	}
 	store.ReadFile = func(fname string) ([]byte, error) {
-		return fmt.Errorf("store.ReadFile() not implemented")
+		return store.ReadFileContext(context.Background(), fname)
 	}
 	store.WriteFile = func(fname string, data []byte, perm os.FileMode) error {
-		return fmt.Errorf("store.WriteFile() not implemented")
+		return store.WriteFileContext(context.Background(), fname, data, perm)
 	}
-	store.ReadDir = func(fname string) ([]os.FileInfo, error) {
-		return fmt.Errof("store.ReadDir() not implemented")
+	store.ReadDir = func(prefix string) ([]os.FileInfo, error) {
+		return store.ReadDirContext(context.Background(), prefix)
+	}
+
+	// Streaming ops
+	store.Open = func(fname string) (io.ReadCloser, error) {
+		return store.OpenContext(context.Background(), fname)
+	}
+	store.OpenWrite = func(fname string, perm os.FileMode) (io.WriteCloser, error) {
+		return store.OpenWriteContext(context.Background(), fname, perm)
+	}
+	store.OpenRange = func(fname string, off, length int64) (io.ReadCloser, error) {
+		return store.OpenRangeContext(context.Background(), fname, off, length)
 	}
 
 	//
-	// Add Path related funcs
+	// Add Path related funcs, blob keys are slash separated so path.* works as-is.
 	//
 	store.Base = func(p string) string {
-		return "" //FIXME: NOT Implemented, path.Base(p)
+		return path.Base(p)
 	}
 	store.Clean = func(p string) string {
-		return "" //FIXME: NOT Implemented, path.Clean(p)
+		return path.Clean(p)
 	}
 	store.Dir = func(p string) string {
-		return "" //FIXME: NOT Implemented, path.Dir(p)
+		return path.Dir(p)
 	}
 	store.Ext = func(p string) string {
-		return "" //FIXME: NOT Implemented, path.Ext(p)
+		return path.Ext(p)
 	}
 	store.IsAbs = func(p string) bool {
-		return "" //FIXME: NOT Implemented, path.IsAbs(p)
+		return path.IsAbs(p)
 	}
 	store.Join = func(elem ...string) string {
-		return "" //FIXME: NOT Implemented, path.Join(elem...)
+		return path.Join(elem...)
 	}
 	store.Match = func(pattern string, name string) (matched bool, err error) {
-		return false, fmt.Errorf("store.Match() not implemented") //FIXME
+		return path.Match(pattern, name)
 	}
 	store.Split = func(p string) (dir, filename string) {
-		return "" //FIXME: NOT Implemented, path.Split(p)
+		return path.Split(p)
 	}
 
 	// Extended ops for datatools and dataset
 
-	// WriteFilter writes a file after running/applying a filter function to its' file pointer
-	// E.g. composing a tarball before storing
+	// WriteFilter stages processor's output through a temp file and only
+	// then streams it into the bucket through OpenWrite, so a processor
+	// that fails leaves the bucket untouched. The bucket writer OpenWrite
+	// returns commits atomically on Close, so (unlike fs.go) no rename
+	// dance is needed for that last step.
 	store.WriteFilter = func(finalPath string, processor func(*os.File) error) error {
-		return fmt.Errorf("store.WriteFillter() not implemented")
+		tmp, err := ioutil.TempFile(os.TempDir(), path.Base(finalPath))
+		if err != nil {
+			return err
+		}
+		tmpName := tmp.Name()
+		defer os.Remove(tmpName)
+
+		if err := processor(tmp); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+
+		fp, err := os.Open(tmpName)
+		if err != nil {
+			return err
+		}
+		defer fp.Close()
+
+		wr, err := store.OpenWrite(finalPath, 0664)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(wr, fp); err != nil {
+			wr.Close()
+			return err
+		}
+		return wr.Close()
 	}
 
 	// Now the store is setup and we're ready to return
 	return store, nil
 }
+
+// cdkBucket returns the *blob.Bucket configured for this store.
+func cdkBucket(s *Store) (*blob.Bucket, error) {
+	if val, ok := s.Config["cdkBucket"]; ok == true {
+		return val.(*blob.Bucket), nil
+	}
+	return nil, fmt.Errorf("cdkBucket not configured")
+}
+
+// cdkCreate takes a full path and a reader of content and writes it to the
+// bucket associated with the Store initialized.
+func cdkCreate(ctx context.Context, s *Store, fname string, rd io.Reader) error {
+	wr, err := cdkOpenWrite(ctx, s, fname)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(wr, rd); err != nil {
+		wr.Close()
+		return err
+	}
+	return wr.Close()
+}
+
+// cdkRead takes a full path and returns the bytes read from the bucket.
+func cdkRead(ctx context.Context, s *Store, fname string) ([]byte, error) {
+	rd, err := cdkOpen(ctx, s, fname)
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	return ioutil.ReadAll(rd)
+}
+
+// cdkOpen returns a streaming reader over fname's bucket object, for
+// callers (Store.Open, cdkRead) that don't want Read/ReadFile's whole
+// object in memory up front.
+func cdkOpen(ctx context.Context, s *Store, fname string) (io.ReadCloser, error) {
+	bucket, err := cdkBucket(s)
+	if err != nil {
+		return nil, err
+	}
+	return bucket.NewReader(ctx, fname, nil)
+}
+
+// cdkOpenWrite returns a streaming writer to fname's bucket object. The
+// writer commits its multipart upload atomically on Close.
+func cdkOpenWrite(ctx context.Context, s *Store, fname string) (io.WriteCloser, error) {
+	bucket, err := cdkBucket(s)
+	if err != nil {
+		return nil, err
+	}
+	return bucket.NewWriter(ctx, fname, nil)
+}
+
+// cdkOpenRange returns a streaming reader over the length bytes of
+// fname's bucket object starting at off, using the blob package's
+// native range support instead of reading and discarding a prefix.
+func cdkOpenRange(ctx context.Context, s *Store, fname string, off, length int64) (io.ReadCloser, error) {
+	bucket, err := cdkBucket(s)
+	if err != nil {
+		return nil, err
+	}
+	return bucket.NewRangeReader(ctx, fname, off, length, nil)
+}
+
+// cdkRemove deletes a single key from the bucket.
+func cdkRemove(ctx context.Context, s *Store, fname string) error {
+	bucket, err := cdkBucket(s)
+	if err != nil {
+		return err
+	}
+	return bucket.Delete(ctx, fname)
+}
+
+// cdkRemoveAll deletes every key sharing prefixName.
+func cdkRemoveAll(ctx context.Context, s *Store, prefixName string) error {
+	bucket, err := cdkBucket(s)
+	if err != nil {
+		return err
+	}
+	iter := bucket.List(&blob.ListOptions{Prefix: prefixName})
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if obj.IsDir {
+			continue
+		}
+		if err := bucket.Delete(ctx, obj.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cdkStat returns an os.FileInfo built from the bucket's object attributes.
+func cdkStat(ctx context.Context, s *Store, fname string) (os.FileInfo, error) {
+	bucket, err := cdkBucket(s)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := bucket.Attributes(ctx, fname)
+	if err != nil {
+		return nil, err
+	}
+	return &cdkObjectInfo{obj: &blob.ListObject{
+		Key:     fname,
+		ModTime: attrs.ModTime,
+		Size:    attrs.Size,
+	}}, nil
+}
+
+// cdkReadDir lists the keys sharing prefix, synthesizing directory entries
+// for "subdirectories" found via the "/" delimiter since blob stores have
+// no real concept of directories.
+func cdkReadDir(ctx context.Context, s *Store, prefix string) ([]os.FileInfo, error) {
+	bucket, err := cdkBucket(s)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
+	}
+	iter := bucket.List(&blob.ListOptions{Prefix: prefix, Delimiter: "/"})
+	var dirInfo []os.FileInfo
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		dirInfo = append(dirInfo, &cdkObjectInfo{obj: obj})
+	}
+	return dirInfo, nil
+}
@@ -0,0 +1,253 @@
+//
+// mem.go provides an in-memory Backend registered under the "mem" scheme.
+// It exists so callers can exercise Store's API in tests (or stage writes
+// in front of a slower backend, see NewCacheOnRead) without touching disc.
+//
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memNode is a single file or directory entry in a memBackend's tree.
+type memNode struct {
+	name    string
+	isDir   bool
+	mode    os.FileMode
+	modTime time.Time
+	data    []byte
+}
+
+func (n *memNode) Name() string       { return path.Base(n.name) }
+func (n *memNode) Size() int64        { return int64(len(n.data)) }
+func (n *memNode) Mode() os.FileMode  { return n.mode }
+func (n *memNode) ModTime() time.Time { return n.modTime }
+func (n *memNode) IsDir() bool        { return n.isDir }
+func (n *memNode) Sys() interface{}   { return nil }
+
+// memBackend is a Backend that keeps every file in memory for the
+// lifetime of the process.
+type memBackend struct {
+	mu    sync.RWMutex
+	files map[string]*memNode
+}
+
+func newMemBackend(opts map[string]interface{}) (Backend, error) {
+	b := &memBackend{files: map[string]*memNode{}}
+	b.files["/"] = &memNode{name: "/", isDir: true, mode: os.ModeDir | 0775, modTime: time.Now()}
+	return b, nil
+}
+
+func (b *memBackend) Name() string { return "mem" }
+
+// key normalizes name to a cleaned, absolute form so lookups are
+// insensitive to leading "./" or missing leading slash.
+func (b *memBackend) key(name string) string {
+	return path.Clean("/" + strings.TrimPrefix(name, "/"))
+}
+
+func (b *memBackend) Create(name string) (File, error) {
+	return b.openFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+}
+
+func (b *memBackend) Open(name string) (File, error) {
+	return b.openFile(name, os.O_RDONLY, 0)
+}
+
+func (b *memBackend) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return b.openFile(name, flag, perm)
+}
+
+func (b *memBackend) openFile(name string, flag int, perm os.FileMode) (File, error) {
+	key := b.key(name)
+	b.mu.Lock()
+	node, ok := b.files[key]
+	if !ok {
+		if flag&os.O_CREATE == 0 {
+			b.mu.Unlock()
+			return nil, os.ErrNotExist
+		}
+		node = &memNode{name: key, mode: perm, modTime: time.Now()}
+		b.files[key] = node
+	} else if flag&os.O_TRUNC != 0 {
+		node.data = nil
+	}
+	b.mu.Unlock()
+	if node.isDir {
+		return &memDirHandle{backend: b, node: node}, nil
+	}
+	return &memFileHandle{backend: b, node: node}, nil
+}
+
+func (b *memBackend) Mkdir(name string, perm os.FileMode) error {
+	key := b.key(name)
+	parent := path.Dir(key)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.files[key]; ok {
+		return os.ErrExist
+	}
+	if _, ok := b.files[parent]; !ok {
+		return os.ErrNotExist
+	}
+	b.files[key] = &memNode{name: key, isDir: true, mode: os.ModeDir | perm, modTime: time.Now()}
+	return nil
+}
+
+func (b *memBackend) MkdirAll(name string, perm os.FileMode) error {
+	key := b.key(name)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cur := ""
+	for _, part := range strings.Split(strings.Trim(key, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		cur = cur + "/" + part
+		if _, ok := b.files[cur]; !ok {
+			b.files[cur] = &memNode{name: cur, isDir: true, mode: os.ModeDir | perm, modTime: time.Now()}
+		}
+	}
+	return nil
+}
+
+func (b *memBackend) Remove(name string) error {
+	key := b.key(name)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.files[key]; !ok {
+		return os.ErrNotExist
+	}
+	delete(b.files, key)
+	return nil
+}
+
+func (b *memBackend) RemoveAll(name string) error {
+	key := b.key(name)
+	prefix := key + "/"
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for k := range b.files {
+		if k == key || strings.HasPrefix(k, prefix) {
+			delete(b.files, k)
+		}
+	}
+	return nil
+}
+
+func (b *memBackend) Rename(oldname, newname string) error {
+	oldKey, newKey := b.key(oldname), b.key(newname)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	node, ok := b.files[oldKey]
+	if !ok {
+		return os.ErrNotExist
+	}
+	node.name = newKey
+	b.files[newKey] = node
+	delete(b.files, oldKey)
+	return nil
+}
+
+func (b *memBackend) Stat(name string) (os.FileInfo, error) {
+	key := b.key(name)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	node, ok := b.files[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return node, nil
+}
+
+// memFileHandle is the File returned for a non-directory memNode.
+type memFileHandle struct {
+	backend *memBackend
+	node    *memNode
+	readOff int64
+}
+
+func (h *memFileHandle) Read(p []byte) (int, error) {
+	h.backend.mu.RLock()
+	defer h.backend.mu.RUnlock()
+	if h.readOff >= int64(len(h.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, h.node.data[h.readOff:])
+	h.readOff += int64(n)
+	return n, nil
+}
+
+func (h *memFileHandle) Write(p []byte) (int, error) {
+	h.backend.mu.Lock()
+	defer h.backend.mu.Unlock()
+	h.node.data = append(h.node.data, p...)
+	h.node.modTime = time.Now()
+	return len(p), nil
+}
+
+func (h *memFileHandle) Close() error { return nil }
+func (h *memFileHandle) Name() string { return h.node.Name() }
+
+func (h *memFileHandle) Stat() (os.FileInfo, error) {
+	return h.node, nil
+}
+
+func (h *memFileHandle) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, fmt.Errorf("%s is not a directory", h.node.name)
+}
+
+// memDirHandle is the File returned for a directory memNode.
+type memDirHandle struct {
+	backend *memBackend
+	node    *memNode
+}
+
+func (h *memDirHandle) Read(p []byte) (int, error) {
+	return 0, fmt.Errorf("%s is a directory", h.node.name)
+}
+
+func (h *memDirHandle) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("%s is a directory", h.node.name)
+}
+
+func (h *memDirHandle) Close() error { return nil }
+func (h *memDirHandle) Name() string { return h.node.Name() }
+
+func (h *memDirHandle) Stat() (os.FileInfo, error) {
+	return h.node, nil
+}
+
+func (h *memDirHandle) Readdir(count int) ([]os.FileInfo, error) {
+	prefix := h.node.name
+	if prefix != "/" {
+		prefix += "/"
+	}
+	h.backend.mu.RLock()
+	defer h.backend.mu.RUnlock()
+	seen := map[string]bool{}
+	var names []string
+	for key := range h.backend.files {
+		if key == h.node.name || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		name := strings.SplitN(strings.TrimPrefix(key, prefix), "/", 2)[0]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	infos := make([]os.FileInfo, 0, len(names))
+	for _, name := range names {
+		infos = append(infos, h.backend.files[path.Join(prefix, name)])
+	}
+	return infos, nil
+}
@@ -0,0 +1,451 @@
+// overlay.go adds two composite Store constructors built out of two
+// existing Stores: NewOverlay (copy-on-write) and NewCacheOnRead
+// (read-through caching), analogous to afero's CopyOnWriteFs/CacheOnReadFs.
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// whiteoutsFile is where NewOverlay records base-only files that have
+// been deleted through the overlay, so Stat/Read/ReadDir can report
+// ENOENT for them even though base still has the bytes.
+const whiteoutsFile = ".whiteouts"
+
+// NewOverlay returns a Store whose reads fall through to base whenever
+// overlay doesn't have the file, and whose writes (Create/Update/
+// WriteFile/Mkdir/Delete) land in overlay only, leaving base untouched.
+// This lets callers run mutating tests against a read-only backend (an
+// S3 bucket, say) with all changes captured locally.
+func NewOverlay(base, overlay *Store) *Store {
+	store := new(Store)
+	store.Type = overlay.Type
+	store.Config = map[string]interface{}{
+		"base":    base,
+		"overlay": overlay,
+	}
+
+	store.CreateContext = func(ctx context.Context, fname string, rd io.Reader) error {
+		if err := overlayUnwhiteout(overlay, fname); err != nil {
+			return err
+		}
+		return overlay.CreateContext(ctx, fname, rd)
+	}
+	store.UpdateContext = store.CreateContext
+	store.WriteFileContext = func(ctx context.Context, fname string, data []byte, perm os.FileMode) error {
+		if err := overlayUnwhiteout(overlay, fname); err != nil {
+			return err
+		}
+		return overlay.WriteFileContext(ctx, fname, data, perm)
+	}
+	store.DeleteContext = func(ctx context.Context, fname string) error {
+		overlay.DeleteContext(ctx, fname)
+		if _, err := base.StatContext(ctx, fname); err == nil {
+			return overlayWhiteout(overlay, fname)
+		}
+		return nil
+	}
+
+	store.ReadContext = func(ctx context.Context, fname string) ([]byte, error) {
+		if overlayIsWhiteout(overlay, fname) {
+			return nil, os.ErrNotExist
+		}
+		if data, err := overlay.ReadContext(ctx, fname); err == nil {
+			return data, nil
+		}
+		return base.ReadContext(ctx, fname)
+	}
+	store.ReadFileContext = store.ReadContext
+
+	store.StatContext = func(ctx context.Context, fname string) (os.FileInfo, error) {
+		if overlayIsWhiteout(overlay, fname) {
+			return nil, os.ErrNotExist
+		}
+		if info, err := overlay.StatContext(ctx, fname); err == nil {
+			return info, nil
+		}
+		return base.StatContext(ctx, fname)
+	}
+
+	store.ReadDirContext = func(ctx context.Context, name string) ([]os.FileInfo, error) {
+		return overlayReadDir(base, overlay, name)
+	}
+
+	store.OpenContext = func(ctx context.Context, fname string) (io.ReadCloser, error) {
+		if overlayIsWhiteout(overlay, fname) {
+			return nil, os.ErrNotExist
+		}
+		if rd, err := overlay.OpenContext(ctx, fname); err == nil {
+			return rd, nil
+		}
+		return base.OpenContext(ctx, fname)
+	}
+	store.OpenWriteContext = func(ctx context.Context, fname string, perm os.FileMode) (io.WriteCloser, error) {
+		if err := overlayUnwhiteout(overlay, fname); err != nil {
+			return nil, err
+		}
+		return overlay.OpenWriteContext(ctx, fname, perm)
+	}
+	store.OpenRangeContext = func(ctx context.Context, fname string, off, length int64) (io.ReadCloser, error) {
+		if overlayIsWhiteout(overlay, fname) {
+			return nil, os.ErrNotExist
+		}
+		if rd, err := overlay.OpenRangeContext(ctx, fname, off, length); err == nil {
+			return rd, nil
+		}
+		return base.OpenRangeContext(ctx, fname, off, length)
+	}
+
+	store.Create = func(fname string, rd io.Reader) error {
+		return store.CreateContext(context.Background(), fname, rd)
+	}
+	store.Update = store.Create
+	store.WriteFile = func(fname string, data []byte, perm os.FileMode) error {
+		return store.WriteFileContext(context.Background(), fname, data, perm)
+	}
+	store.Delete = func(fname string) error {
+		return store.DeleteContext(context.Background(), fname)
+	}
+	store.Remove = store.Delete
+	store.RemoveAll = func(prefix string) error {
+		overlay.RemoveAll(prefix)
+		if _, err := base.Stat(prefix); err == nil {
+			return overlayWhiteout(overlay, prefix)
+		}
+		return nil
+	}
+
+	store.Read = func(fname string) ([]byte, error) {
+		return store.ReadContext(context.Background(), fname)
+	}
+	store.ReadFile = store.Read
+
+	store.Stat = func(fname string) (os.FileInfo, error) {
+		return store.StatContext(context.Background(), fname)
+	}
+
+	store.Mkdir = func(name string, perm os.FileMode) error {
+		return overlay.Mkdir(name, perm)
+	}
+	store.MkdirAll = func(name string, perm os.FileMode) error {
+		return overlay.MkdirAll(name, perm)
+	}
+
+	store.ReadDir = func(name string) ([]os.FileInfo, error) {
+		return store.ReadDirContext(context.Background(), name)
+	}
+
+	store.WriteFilter = func(finalPath string, processor func(*os.File) error) error {
+		if err := overlayUnwhiteout(overlay, finalPath); err != nil {
+			return err
+		}
+		return overlay.WriteFilter(finalPath, processor)
+	}
+
+	store.Open = func(fname string) (io.ReadCloser, error) {
+		return store.OpenContext(context.Background(), fname)
+	}
+	store.OpenWrite = func(fname string, perm os.FileMode) (io.WriteCloser, error) {
+		return store.OpenWriteContext(context.Background(), fname, perm)
+	}
+	store.OpenRange = func(fname string, off, length int64) (io.ReadCloser, error) {
+		return store.OpenRangeContext(context.Background(), fname, off, length)
+	}
+
+	store.Base = base.Base
+	store.Clean = base.Clean
+	store.Dir = base.Dir
+	store.Ext = base.Ext
+	store.IsAbs = base.IsAbs
+	store.Join = base.Join
+	store.Match = base.Match
+	store.Split = base.Split
+
+	return store
+}
+
+// overlayReadDir merges overlay and base's listing of name, dropping
+// duplicates (overlay wins) and any entries recorded as whiteouts.
+func overlayReadDir(base, overlay *Store, name string) ([]os.FileInfo, error) {
+	whiteouts, err := overlayWhiteoutSet(overlay)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var merged []os.FileInfo
+	overlayEntries, overlayErr := overlay.ReadDir(name)
+	for _, info := range overlayEntries {
+		if info.Name() == whiteoutsFile {
+			continue
+		}
+		seen[info.Name()] = true
+		merged = append(merged, info)
+	}
+
+	baseEntries, baseErr := base.ReadDir(name)
+	for _, info := range baseEntries {
+		if seen[info.Name()] {
+			continue
+		}
+		if whiteouts[path.Join(name, info.Name())] {
+			continue
+		}
+		seen[info.Name()] = true
+		merged = append(merged, info)
+	}
+
+	if overlayErr != nil && baseErr != nil {
+		return nil, baseErr
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Name() < merged[j].Name() })
+	return merged, nil
+}
+
+// overlayWhiteoutSet reads the set of whited-out paths recorded at
+// overlay's root, returning an empty set if none have been recorded yet.
+func overlayWhiteoutSet(overlay *Store) (map[string]bool, error) {
+	set := map[string]bool{}
+	data, err := overlay.Read(whiteoutsFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return set, nil
+		}
+		return set, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			set[line] = true
+		}
+	}
+	return set, nil
+}
+
+// overlayIsWhiteout reports whether fname has been tombstoned.
+func overlayIsWhiteout(overlay *Store, fname string) bool {
+	set, _ := overlayWhiteoutSet(overlay)
+	return set[fname]
+}
+
+// overlayWhiteout records fname as deleted.
+func overlayWhiteout(overlay *Store, fname string) error {
+	set, err := overlayWhiteoutSet(overlay)
+	if err != nil {
+		return err
+	}
+	set[fname] = true
+	return overlayWriteWhiteouts(overlay, set)
+}
+
+// overlayUnwhiteout clears any tombstone on fname, e.g. because it was
+// just (re)created through the overlay.
+func overlayUnwhiteout(overlay *Store, fname string) error {
+	set, err := overlayWhiteoutSet(overlay)
+	if err != nil {
+		return err
+	}
+	if _, ok := set[fname]; ok == false {
+		return nil
+	}
+	delete(set, fname)
+	return overlayWriteWhiteouts(overlay, set)
+}
+
+func overlayWriteWhiteouts(overlay *Store, set map[string]bool) error {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return overlay.WriteFile(whiteoutsFile, []byte(strings.Join(names, "\n")), 0664)
+}
+
+// NewCacheOnRead returns a Store that reads through base, populating
+// cache on first read and again once ttl has elapsed since the last
+// refresh, analogous to afero's CacheOnReadFs. Writes always go to base;
+// cache is simply invalidated so the next read refreshes it.
+func NewCacheOnRead(base, cache *Store, ttl time.Duration) *Store {
+	store := new(Store)
+	store.Type = base.Type
+	store.Config = map[string]interface{}{
+		"base":  base,
+		"cache": cache,
+	}
+
+	var mu sync.Mutex
+	expiresAt := map[string]time.Time{}
+	isFresh := func(fname string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		t, ok := expiresAt[fname]
+		return ok && time.Now().Before(t)
+	}
+	markFresh := func(fname string) {
+		mu.Lock()
+		defer mu.Unlock()
+		expiresAt[fname] = time.Now().Add(ttl)
+	}
+	invalidate := func(fname string) {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(expiresAt, fname)
+	}
+
+	store.ReadContext = func(ctx context.Context, fname string) ([]byte, error) {
+		if isFresh(fname) {
+			if data, err := cache.ReadContext(ctx, fname); err == nil {
+				return data, nil
+			}
+		}
+		data, err := base.ReadContext(ctx, fname)
+		if err != nil {
+			return nil, err
+		}
+		if err := cache.WriteFileContext(ctx, fname, data, 0664); err == nil {
+			markFresh(fname)
+		}
+		return data, nil
+	}
+	store.ReadFileContext = store.ReadContext
+	store.Read = func(fname string) ([]byte, error) {
+		return store.ReadContext(context.Background(), fname)
+	}
+	store.ReadFile = store.Read
+
+	store.CreateContext = func(ctx context.Context, fname string, rd io.Reader) error {
+		invalidate(fname)
+		return base.CreateContext(ctx, fname, rd)
+	}
+	store.UpdateContext = func(ctx context.Context, fname string, rd io.Reader) error {
+		invalidate(fname)
+		return base.UpdateContext(ctx, fname, rd)
+	}
+	store.WriteFileContext = func(ctx context.Context, fname string, data []byte, perm os.FileMode) error {
+		invalidate(fname)
+		return base.WriteFileContext(ctx, fname, data, perm)
+	}
+	store.DeleteContext = func(ctx context.Context, fname string) error {
+		invalidate(fname)
+		cache.DeleteContext(ctx, fname)
+		return base.DeleteContext(ctx, fname)
+	}
+	store.Create = func(fname string, rd io.Reader) error {
+		return store.CreateContext(context.Background(), fname, rd)
+	}
+	store.Update = func(fname string, rd io.Reader) error {
+		return store.UpdateContext(context.Background(), fname, rd)
+	}
+	store.WriteFile = func(fname string, data []byte, perm os.FileMode) error {
+		return store.WriteFileContext(context.Background(), fname, data, perm)
+	}
+	store.Delete = func(fname string) error {
+		return store.DeleteContext(context.Background(), fname)
+	}
+	store.Remove = store.Delete
+	store.RemoveAll = func(prefix string) error {
+		return base.RemoveAll(prefix)
+	}
+
+	store.Stat = base.Stat
+	store.StatContext = base.StatContext
+	store.Mkdir = base.Mkdir
+	store.MkdirAll = base.MkdirAll
+	store.ReadDir = base.ReadDir
+	store.ReadDirContext = base.ReadDirContext
+	store.WriteFilter = base.WriteFilter
+
+	store.OpenContext = func(ctx context.Context, fname string) (io.ReadCloser, error) {
+		if isFresh(fname) {
+			if rd, err := cache.OpenContext(ctx, fname); err == nil {
+				return rd, nil
+			}
+		}
+		rd, err := base.OpenContext(ctx, fname)
+		if err != nil {
+			return nil, err
+		}
+		wr, err := cache.OpenWriteContext(ctx, fname, 0664)
+		if err != nil {
+			// Caching is a best effort optimization; fall back to an
+			// uncached stream rather than failing the read outright.
+			return rd, nil
+		}
+		return &cacheOnReadTee{rd: rd, wr: wr, fname: fname, markFresh: markFresh}, nil
+	}
+	store.OpenWriteContext = func(ctx context.Context, fname string, perm os.FileMode) (io.WriteCloser, error) {
+		invalidate(fname)
+		return base.OpenWriteContext(ctx, fname, perm)
+	}
+	store.OpenRangeContext = func(ctx context.Context, fname string, off, length int64) (io.ReadCloser, error) {
+		// Ranges are partial by nature, so there's little to gain from
+		// caching them the way whole-object Open/Read results are; just
+		// pass through to base.
+		return base.OpenRangeContext(ctx, fname, off, length)
+	}
+	store.Open = func(fname string) (io.ReadCloser, error) {
+		return store.OpenContext(context.Background(), fname)
+	}
+	store.OpenWrite = func(fname string, perm os.FileMode) (io.WriteCloser, error) {
+		return store.OpenWriteContext(context.Background(), fname, perm)
+	}
+	store.OpenRange = func(fname string, off, length int64) (io.ReadCloser, error) {
+		return store.OpenRangeContext(context.Background(), fname, off, length)
+	}
+
+	store.Base = base.Base
+	store.Clean = base.Clean
+	store.Dir = base.Dir
+	store.Ext = base.Ext
+	store.IsAbs = base.IsAbs
+	store.Join = base.Join
+	store.Match = base.Match
+	store.Split = base.Split
+
+	return store
+}
+
+// cacheOnReadTee streams base's bytes straight through to the caller
+// while copying the same bytes into cache, so the next Open/Read within
+// ttl is served from cache instead of base. The copy is only trusted
+// once the caller has read through to EOF and Close reports no write
+// errors, at which point fname is marked fresh the same as a populated
+// Read.
+type cacheOnReadTee struct {
+	rd        io.ReadCloser
+	wr        io.WriteCloser
+	fname     string
+	markFresh func(string)
+	failed    bool
+	eof       bool
+}
+
+func (t *cacheOnReadTee) Read(p []byte) (int, error) {
+	n, err := t.rd.Read(p)
+	if n > 0 {
+		if _, werr := t.wr.Write(p[:n]); werr != nil {
+			t.failed = true
+		}
+	}
+	if err == io.EOF {
+		t.eof = true
+	}
+	return n, err
+}
+
+func (t *cacheOnReadTee) Close() error {
+	err := t.rd.Close()
+	if werr := t.wr.Close(); werr != nil {
+		t.failed = true
+	}
+	if !t.failed && t.eof {
+		t.markFresh(t.fname)
+	}
+	return err
+}
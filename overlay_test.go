@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestOverlay(t *testing.T) {
+	base, err := GetStore("mem://")
+	if err != nil {
+		t.Errorf("GetStore(base) failed, %s", err)
+		t.FailNow()
+	}
+	overlay, err := GetStore("mem://")
+	if err != nil {
+		t.Errorf("GetStore(overlay) failed, %s", err)
+		t.FailNow()
+	}
+	if err := base.Create("base-only.txt", bytes.NewReader([]byte("from base"))); err != nil {
+		t.Errorf("base.Create failed, %s", err)
+		t.FailNow()
+	}
+
+	store := NewOverlay(base, overlay)
+
+	// Reads fall through to base when overlay doesn't have the file.
+	data, err := store.Read("base-only.txt")
+	if err != nil {
+		t.Errorf("Read(base-only.txt) failed, %s", err)
+		t.FailNow()
+	}
+	if bytes.Compare(data, []byte("from base")) != 0 {
+		t.Errorf("expected %q, got %q", "from base", data)
+	}
+
+	// Writes land in overlay only, base is untouched.
+	if err := store.Create("overlay-only.txt", bytes.NewReader([]byte("from overlay"))); err != nil {
+		t.Errorf("Create(overlay-only.txt) failed, %s", err)
+		t.FailNow()
+	}
+	if _, err := base.Stat("overlay-only.txt"); err == nil {
+		t.Errorf("expected base to not have overlay-only.txt")
+	}
+
+	// Deleting a base-only file tombstones it rather than touching base.
+	if err := store.Delete("base-only.txt"); err != nil {
+		t.Errorf("Delete(base-only.txt) failed, %s", err)
+		t.FailNow()
+	}
+	if _, err := store.Stat("base-only.txt"); err == nil {
+		t.Errorf("expected base-only.txt to report not exist after delete")
+	}
+	if _, err := base.Stat("base-only.txt"); err != nil {
+		t.Errorf("expected base to still have base-only.txt, base must stay immutable")
+	}
+
+	// ReadDir merges both layers and hides the tombstoned name.
+	dirInfo, err := store.ReadDir(".")
+	if err != nil {
+		t.Errorf("ReadDir failed, %s", err)
+		t.FailNow()
+	}
+	names := map[string]bool{}
+	for _, info := range dirInfo {
+		names[info.Name()] = true
+	}
+	if names["base-only.txt"] {
+		t.Errorf("expected base-only.txt to be hidden by whiteout")
+	}
+	if names["overlay-only.txt"] == false {
+		t.Errorf("expected overlay-only.txt in merged ReadDir results")
+	}
+
+	// Streaming reads see files written through the overlay.
+	rd, err := store.Open("overlay-only.txt")
+	if err != nil {
+		t.Errorf("Open(overlay-only.txt) failed, %s", err)
+		t.FailNow()
+	}
+	streamed, err := ioutil.ReadAll(rd)
+	rd.Close()
+	if err != nil {
+		t.Errorf("ReadAll(overlay-only.txt) failed, %s", err)
+		t.FailNow()
+	}
+	if bytes.Compare(streamed, []byte("from overlay")) != 0 {
+		t.Errorf("expected %q, got %q", "from overlay", streamed)
+	}
+}
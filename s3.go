@@ -1,10 +1,9 @@
-//
 // s3.go adds s3:// (Amazon S3 storage) support to storage.go
-//
 package storage
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -16,12 +15,19 @@ import (
 
 	// 3rd Party Packages
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
+// s3MinPartSize is the smallest part size S3 accepts for a multipart
+// upload; anything smaller is bumped up to this.
+const s3MinPartSize = 5 * 1024 * 1024
+
 // s3ObjectInfo is a map so we can create a os.FileInfo compatible struct from S3 objects
 type s3ObjectInfo struct {
 	Info map[string]interface{}
@@ -84,16 +90,63 @@ func (d *s3ObjectInfo) Mode() os.FileMode {
 	return os.FileMode(0)
 }
 
-// IsDir returns false, S3 doens't support the concept of directories only keys in buckets
+// IsDir returns true for the synthetic entries s3WalkDir builds from
+// CommonPrefixes, false for everything else, since S3 itself has no
+// concept of directories, only keys in a bucket.
 func (d *s3ObjectInfo) IsDir() bool {
+	if val, ok := d.Info["IsDir"]; ok == true {
+		return val.(bool)
+	}
 	return false
 }
 
+// s3ToPrefixInfo builds a synthetic directory entry from one of
+// ListObjectsV2's CommonPrefixes, the "folder" S3 reports when a
+// Delimiter is given.
+func s3ToPrefixInfo(p *s3.CommonPrefix) *s3ObjectInfo {
+	doc := new(s3ObjectInfo)
+	doc.Info = map[string]interface{}{}
+	doc.Info["Key"] = p.Prefix
+	doc.Info["IsDir"] = true
+	return doc
+}
+
 // Sys() returns an system dependant interface...
 func (d *s3ObjectInfo) Sys() interface{} {
 	return nil
 }
 
+// s3AwsConfig builds an aws.Config from store.Config's Aws* keys, so
+// the s3:// scheme can target any S3-compatible service rather than
+// AWS itself: AwsEndpoint (e.g. "http://localhost:4566") for
+// LocalStack/MinIO/Ceph RGW/Wasabi, AwsS3ForcePathStyle since most of
+// those require path-style addressing instead of AWS's virtual-hosted
+// style, AwsDisableSSL for a plain-http endpoint, and static
+// credentials (AwsAccessKeyID/AwsSecretAccessKey/AwsSessionToken) for
+// when the target has no shared config/env credentials of its own.
+func s3AwsConfig(s *Store) aws.Config {
+	var cfg aws.Config
+	if val, ok := s.Config["AwsRegion"]; ok == true {
+		cfg.Region = aws.String(val.(string))
+	}
+	if val, ok := s.Config["AwsEndpoint"]; ok == true {
+		cfg.Endpoint = aws.String(val.(string))
+	}
+	if val, ok := s.Config["AwsS3ForcePathStyle"]; ok == true {
+		cfg.S3ForcePathStyle = aws.Bool(val.(bool))
+	}
+	if val, ok := s.Config["AwsDisableSSL"]; ok == true {
+		cfg.DisableSSL = aws.Bool(val.(bool))
+	}
+	if _, ok := s.Config["AwsAccessKeyID"]; ok == true {
+		accessKeyID, _ := s.Config["AwsAccessKeyID"].(string)
+		secretAccessKey, _ := s.Config["AwsSecretAccessKey"].(string)
+		sessionToken, _ := s.Config["AwsSessionToken"].(string)
+		cfg.Credentials = credentials.NewStaticCredentials(accessKeyID, secretAccessKey, sessionToken)
+	}
+	return cfg
+}
+
 // s3Configure is a function that configures a storage.Store for use with AWS S3
 func s3Configure(store *Store) (*Store, error) {
 	var (
@@ -127,16 +180,15 @@ func s3Configure(store *Store) (*Store, error) {
 		} else {
 			opts.SharedConfigState = session.SharedConfigDisable
 		}
-		if val, ok := store.Config["AwsRegion"]; ok == true {
-			opts.Config = aws.Config{Region: aws.String(val.(string))}
-		}
+		opts.Config = s3AwsConfig(store)
 
 		sess, err = session.NewSessionWithOptions(opts)
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		sess, err = session.NewSession()
+		awsConfig := s3AwsConfig(store)
+		sess, err = session.NewSession(&awsConfig)
 		if err != nil {
 			return nil, err
 		}
@@ -185,44 +237,184 @@ func s3Configure(store *Store) (*Store, error) {
 	store.WriteFile = func(fname string, data []byte, perm os.FileMode) error {
 		return s3Create(store, fname, bytes.NewBuffer(data))
 	}
-	store.ReadDir = func(fname string) ([]os.FileInfo, error) {
-		//NOTE: S3 lacks the concept of directories, FIXME: Need to list paths with same prefix
-		return nil, nil
+	store.ReadDirContext = func(ctx context.Context, prefix string) ([]os.FileInfo, error) {
+		return s3ReadDir(ctx, store, prefix)
+	}
+	store.ReadDir = func(prefix string) ([]os.FileInfo, error) {
+		return store.ReadDirContext(context.Background(), prefix)
+	}
+	// WalkDirFn streams CommonPrefixes/Contents straight off each
+	// ListObjectsV2 page to fn, so a prefix with millions of keys never
+	// has to be materialized into a single []os.FileInfo the way ReadDir
+	// does.
+	store.WalkDirFn = func(prefix string, fn func(os.FileInfo) error) error {
+		return s3WalkDir(context.Background(), store, prefix, fn)
+	}
+
+	// Bucket lifecycle, for callers provisioning a per-tenant bucket
+	// instead of hand-creating one in the console.
+	store.BucketCreate = func(name string, opts BucketOptions) error {
+		return s3BucketCreate(store, name, opts)
+	}
+	store.BucketDelete = func(name string) error {
+		return s3BucketDelete(store, name)
+	}
+	store.BucketExists = func(name string) (bool, error) {
+		return s3BucketExists(store, name)
+	}
+
+	// SignedURL lets a caller hand a browser/uploader a time-limited
+	// URL straight to the object instead of proxying the bytes through
+	// this process.
+	store.SignedURL = func(fname string, method string, expires time.Duration) (string, error) {
+		return s3SignedURL(store, fname, method, expires)
+	}
+
+	// Range reads, for random access into a large object (e.g. reading
+	// a single file out of a multi-GB tarball) without downloading the
+	// whole thing the way Read does.
+	store.ReadRange = func(fname string, offset, length int64) ([]byte, error) {
+		return s3ReadRange(store, fname, offset, length)
+	}
+	store.OpenReaderAt = func(fname string) (ReaderAtCloser, int64, error) {
+		return s3OpenReaderAt(store, fname)
+	}
+
+	// Streaming ops. OpenWrite/OpenWriteContext hand back the write end of
+	// an io.Pipe feeding a multipart upload, so callers can write an
+	// object incrementally instead of handing s3Create a complete
+	// io.Reader up front. Cancelling ctx aborts the in-flight upload
+	// rather than completing it; see s3OpenWriteContext.
+	store.OpenWriteContext = func(ctx context.Context, fname string, perm os.FileMode) (io.WriteCloser, error) {
+		return s3OpenWriteContext(ctx, store, fname)
+	}
+	store.OpenWrite = func(fname string, perm os.FileMode) (io.WriteCloser, error) {
+		return store.OpenWriteContext(context.Background(), fname, perm)
 	}
 
 	// Extended options for datatools and dataset
 
-	// WriteFilter writes a file after running apply a filter function to its' file pointer
-	// E.g. composing a tarball before uploading results to S3
+	// WriteFilter runs processor against an os.Pipe instead of a temp
+	// file, so its output streams straight into the multipart upload via
+	// OpenWrite without ever touching disk or buffering fully in memory;
+	// see streamWriteFilter.
 	store.WriteFilter = func(finalPath string, processor func(fp *os.File) error) error {
-		// Open temp file as file point
-		tmp, err := ioutil.TempFile(os.TempDir(), path.Base(finalPath))
-		if err != nil {
-			return err
-		}
-		tmpName := tmp.Name()
-		defer os.Remove(tmpName)
+		return streamWriteFilter(store, finalPath, processor)
+	}
+
+	// Now the store is setup and we're ready to return
+	return store, nil
+}
 
-		// Envoke processor function
-		err = processor(tmp)
+// s3BucketCreate provisions name as a new S3 bucket. If opts.Region is
+// set it's passed through as the bucket's LocationConstraint; if
+// opts.Versioning is set, versioning is enabled on the bucket after
+// creation. With opts.ReuseExisting, a bucket the caller already owns
+// (ErrCodeBucketAlreadyOwnedByYou) is treated as success rather than an
+// error, so provisioning code can be called idempotently.
+func s3BucketCreate(s *Store, name string, opts BucketOptions) error {
+	val, ok := s.Config["s3Service"]
+	if ok == false {
+		return fmt.Errorf("s3Service not configured")
+	}
+	s3Svc := val.(s3iface.S3API)
+
+	createParams := &s3.CreateBucketInput{
+		Bucket: &name,
+	}
+	if opts.Region != "" {
+		createParams.CreateBucketConfiguration = &s3.CreateBucketConfiguration{
+			LocationConstraint: &opts.Region,
+		}
+	}
+	_, err := s3Svc.CreateBucket(createParams)
+	if err != nil {
+		if opts.ReuseExisting == true {
+			if awsErr, ok := err.(awserr.Error); ok == true && awsErr.Code() == s3.ErrCodeBucketAlreadyOwnedByYou {
+				err = nil
+			}
+		}
 		if err != nil {
 			return err
 		}
-		err = tmp.Close()
+	}
+	if opts.Versioning == true {
+		_, err := s3Svc.PutBucketVersioning(&s3.PutBucketVersioningInput{
+			Bucket: &name,
+			VersioningConfiguration: &s3.VersioningConfiguration{
+				Status: aws.String(s3.BucketVersioningStatusEnabled),
+			},
+		})
 		if err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
-		// Now we're ready to upload results
-		buf, err := ioutil.ReadFile(tmpName)
-		if err != nil {
-			return err
+// s3BucketDelete removes the named bucket. S3 requires a bucket be
+// empty before it can be deleted; callers should RemoveAll its contents
+// first.
+func s3BucketDelete(s *Store, name string) error {
+	val, ok := s.Config["s3Service"]
+	if ok == false {
+		return fmt.Errorf("s3Service not configured")
+	}
+	s3Svc := val.(s3iface.S3API)
+	_, err := s3Svc.DeleteBucket(&s3.DeleteBucketInput{Bucket: &name})
+	return err
+}
+
+// s3BucketExists reports whether name exists and is accessible to the
+// configured credentials, via HeadBucket. A "not found"/"forbidden"
+// response is reported as (false, nil) rather than an error; any other
+// failure (e.g. a network error) is returned as-is.
+func s3BucketExists(s *Store, name string) (bool, error) {
+	val, ok := s.Config["s3Service"]
+	if ok == false {
+		return false, fmt.Errorf("s3Service not configured")
+	}
+	s3Svc := val.(s3iface.S3API)
+	_, err := s3Svc.HeadBucket(&s3.HeadBucketInput{Bucket: &name})
+	if err == nil {
+		return true, nil
+	}
+	if awsErr, ok := err.(awserr.Error); ok == true {
+		switch awsErr.Code() {
+		case "NotFound", "Forbidden":
+			return false, nil
 		}
-		return s3Create(store, finalPath, bytes.NewReader(buf))
 	}
+	return false, err
+}
 
-	// Now the store is setup and we're ready to return
-	return store, nil
+// s3SignedURL returns a URL granting method-scoped access to fname for
+// expires, via the matching *Request's own Presign, so a caller can hand
+// it to a browser or uploader without proxying the bytes through this
+// process or handing out real credentials.
+func s3SignedURL(s *Store, fname string, method string, expires time.Duration) (string, error) {
+	val, ok := s.Config["s3Service"]
+	if ok == false {
+		return "", fmt.Errorf("s3Service not configured")
+	}
+	s3Svc := val.(s3iface.S3API)
+	if _, ok := s.Config["AwsBucket"]; ok == false {
+		return "", fmt.Errorf("Bucket not defined for %s", fname)
+	}
+	bucketName := s.Config["AwsBucket"].(string)
+
+	var req *request.Request
+	switch strings.ToUpper(method) {
+	case "GET":
+		req, _ = s3Svc.GetObjectRequest(&s3.GetObjectInput{Bucket: &bucketName, Key: &fname})
+	case "PUT":
+		req, _ = s3Svc.PutObjectRequest(&s3.PutObjectInput{Bucket: &bucketName, Key: &fname})
+	case "DELETE":
+		req, _ = s3Svc.DeleteObjectRequest(&s3.DeleteObjectInput{Bucket: &bucketName, Key: &fname})
+	default:
+		return "", fmt.Errorf("unsupported method %q for SignedURL", method)
+	}
+	return req.Presign(expires)
 }
 
 // S3Stat takes a file name and returns a FileInfo and error value
@@ -278,6 +470,132 @@ func s3Create(s *Store, fname string, rd io.Reader) error {
 	return fmt.Errorf("s3Service not configured")
 }
 
+// s3UploaderOptions reads PartSize/Concurrency overrides from s.Config,
+// defaulting to 5MiB parts / 5 concurrent parts and enforcing S3's 5MiB
+// minimum part size on whatever was configured.
+func s3UploaderOptions(s *Store) (partSize int64, concurrency int) {
+	partSize, concurrency = s3MinPartSize, 5
+	if val, ok := s.Config["S3PartSize"]; ok == true {
+		if v, ok := val.(int64); ok == true && v > s3MinPartSize {
+			partSize = v
+		}
+	}
+	if val, ok := s.Config["S3Concurrency"]; ok == true {
+		if v, ok := val.(int); ok == true && v > 0 {
+			concurrency = v
+		}
+	}
+	return partSize, concurrency
+}
+
+// s3PipeUploader adapts an io.Pipe into the io.WriteCloser OpenWrite
+// needs, feeding the pipe's read end to s3manager.Uploader as the
+// upload Body. Close blocks until the upload goroutine finishes and
+// reports whatever error it hit.
+type s3PipeUploader struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func (u *s3PipeUploader) Write(p []byte) (int, error) {
+	return u.pw.Write(p)
+}
+
+func (u *s3PipeUploader) Close() error {
+	u.pw.Close()
+	return <-u.done
+}
+
+// s3OpenWriteContext returns a writer that streams fname's content
+// straight into an S3 multipart upload, so callers (OpenWrite,
+// WriteFilter) never have to hold the whole object in memory the way
+// s3Create's bytes.Reader-backed uploads do. Cancelling ctx fails the
+// upload in progress; s3manager.Uploader aborts the multipart upload on
+// any upload error rather than leaving an orphaned one behind.
+func s3OpenWriteContext(ctx context.Context, s *Store, fname string) (io.WriteCloser, error) {
+	val, ok := s.Config["s3Service"]
+	if ok == false {
+		return nil, fmt.Errorf("s3Service not configured")
+	}
+	s3Svc := val.(s3iface.S3API)
+	if _, ok := s.Config["AwsBucket"]; ok == false {
+		return nil, fmt.Errorf("Bucket not defined for %s", fname)
+	}
+	bucketName := s.Config["AwsBucket"].(string)
+	partSize, concurrency := s3UploaderOptions(s)
+
+	pr, pw := io.Pipe()
+	uploader := s3manager.NewUploaderWithClient(s3Svc, func(u *s3manager.Uploader) {
+		u.PartSize = partSize
+		u.Concurrency = concurrency
+	})
+	done := make(chan error, 1)
+	go func() {
+		_, err := uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+			Bucket: &bucketName,
+			Key:    &fname,
+			Body:   pr,
+		})
+		pr.CloseWithError(err)
+		done <- err
+	}()
+	return &s3PipeUploader{pw: pw, done: done}, nil
+}
+
+// s3WalkDir pages through prefix with ListObjectsV2, using Delimiter
+// "/" so keys one level down collapse into CommonPrefixes, and calls fn
+// once per CommonPrefix (reported as a synthetic, IsDir()==true entry)
+// and once per Content, stopping as soon as fn returns an error.
+func s3WalkDir(ctx context.Context, s *Store, prefix string, fn func(os.FileInfo) error) error {
+	val, ok := s.Config["s3Service"]
+	if ok == false {
+		return fmt.Errorf("s3Service not configured")
+	}
+	s3Svc := val.(s3iface.S3API)
+	if _, ok := s.Config["AwsBucket"]; ok == false {
+		return fmt.Errorf("Bucket not defined for %s", prefix)
+	}
+	bucketName := s.Config["AwsBucket"].(string)
+	delimiter := "/"
+	listParams := &s3.ListObjectsV2Input{
+		Bucket:    &bucketName,
+		Prefix:    &prefix,
+		Delimiter: &delimiter,
+	}
+	var fnErr error
+	err := s3Svc.ListObjectsV2PagesWithContext(ctx, listParams, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, p := range page.CommonPrefixes {
+			if fnErr = fn(s3ToPrefixInfo(p)); fnErr != nil {
+				return false
+			}
+		}
+		for _, obj := range page.Contents {
+			if fnErr = fn(s3ToObjectInfo(obj)); fnErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// s3ReadDir materializes s3WalkDir's results into a single slice, for
+// callers that want the whole listing rather than a streaming callback.
+func s3ReadDir(ctx context.Context, s *Store, prefix string) ([]os.FileInfo, error) {
+	var entries []os.FileInfo
+	err := s3WalkDir(ctx, s, prefix, func(info os.FileInfo) error {
+		entries = append(entries, info)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
 // s3Read takes a full path and returns a byte array and error from the bucket read
 func s3Read(s *Store, fname string) ([]byte, error) {
 	if val, ok := s.Config["s3Service"]; ok == true {
@@ -301,6 +619,68 @@ func s3Read(s *Store, fname string) ([]byte, error) {
 	return nil, fmt.Errorf("s3Service not configured")
 }
 
+// s3ReadRange fetches length bytes of fname starting at offset via
+// GetObjectInput's Range header, instead of downloading the whole
+// object the way s3Read does.
+func s3ReadRange(s *Store, fname string, offset, length int64) ([]byte, error) {
+	val, ok := s.Config["s3Service"]
+	if ok == false {
+		return nil, fmt.Errorf("s3Service not configured")
+	}
+	s3Svc := val.(s3iface.S3API)
+	if _, ok := s.Config["AwsBucket"]; ok == false {
+		return nil, fmt.Errorf("Bucket not defined for %s", fname)
+	}
+	bucketName := s.Config["AwsBucket"].(string)
+	rangeHeader := fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+
+	out, err := s3Svc.GetObject(&s3.GetObjectInput{
+		Bucket: &bucketName,
+		Key:    &fname,
+		Range:  &rangeHeader,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return ioutil.ReadAll(out.Body)
+}
+
+// s3ReaderAt implements io.ReaderAt over an S3 object, issuing one
+// ranged GetObject per ReadAt call. It holds no connection of its own,
+// so Close is a no-op.
+type s3ReaderAt struct {
+	s     *Store
+	fname string
+}
+
+func (r *s3ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	data, err := s3ReadRange(r.s, r.fname, off, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, data)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *s3ReaderAt) Close() error {
+	return nil
+}
+
+// s3OpenReaderAt returns an io.ReaderAt over fname along with its total
+// size, fetched once via s3Stat so callers like archive/zip.NewReader
+// can seek without a Stat round trip per read.
+func s3OpenReaderAt(s *Store, fname string) (ReaderAtCloser, int64, error) {
+	info, err := s3Stat(s, fname)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &s3ReaderAt{s: s, fname: fname}, info.Size(), nil
+}
+
 // s3Remove takes a full path and returns an error if delete not successful
 func s3Remove(s *Store, fname string) error {
 	if val, ok := s.Config["s3Service"]; ok == true {
@@ -319,45 +699,55 @@ func s3Remove(s *Store, fname string) error {
 	return fmt.Errorf("s3Service not configured")
 }
 
-// s3RemoveAll takes a path prefix and delete matching items (up to 1000) and returns an error if delete not successful
+// s3RemoveAll takes a path prefix, pages through every matching key with
+// ListObjectsV2's ContinuationToken, and deletes them in batches of up
+// to 1000 via DeleteObjects. Per-key failures reported back by
+// DeleteObjects are collected into a *MultiError rather than aborting
+// the rest of the batch.
 func s3RemoveAll(s *Store, prefixName string) error {
-	if val, ok := s.Config["s3Service"]; ok == true {
-		s3Svc := val.(s3iface.S3API)
-		if _, ok := s.Config["AwsBucket"]; ok == false {
-			return fmt.Errorf("Bucket not defined for %s", prefixName)
-		}
-		bucketName := s.Config["AwsBucket"].(string)
-		// FIXME: Get a list of objects, then delate each one
-		statParams := &s3.ListObjectsInput{
-			Bucket: &bucketName,
-			Prefix: &prefixName,
-		}
-		// S3 ListObjects returns an maximum of 1000 objects, I am using an outer loop to handle
-		// the case of where the prefix matches more than 1000 objects.
-		res, err := s3Svc.ListObjects(statParams)
+	val, ok := s.Config["s3Service"]
+	if ok == false {
+		return fmt.Errorf("s3Service not configured")
+	}
+	s3Svc := val.(s3iface.S3API)
+	if _, ok := s.Config["AwsBucket"]; ok == false {
+		return fmt.Errorf("Bucket not defined for %s", prefixName)
+	}
+	bucketName := s.Config["AwsBucket"].(string)
+
+	merr := &MultiError{}
+	listParams := &s3.ListObjectsV2Input{
+		Bucket: &bucketName,
+		Prefix: &prefixName,
+	}
+	for {
+		page, err := s3Svc.ListObjectsV2(listParams)
 		if err != nil {
 			return err
 		}
-		cnt := len(res.Contents)
-		for cnt > 0 {
-			// NOTE: Only return the fname we're looking for not the other ones with matching prefix
-			for _, obj := range res.Contents {
-				deleteParams := &s3.DeleteObjectInput{
-					Bucket: &bucketName,
-					Key:    obj.Key,
-				}
-				_, err := s3Svc.DeleteObject(deleteParams)
-				if err != nil {
-					return err
-				}
+		if len(page.Contents) > 0 {
+			objects := make([]*s3.ObjectIdentifier, len(page.Contents))
+			for i, obj := range page.Contents {
+				objects[i] = &s3.ObjectIdentifier{Key: obj.Key}
 			}
-			res, err := s3Svc.ListObjects(statParams)
+			delRes, err := s3Svc.DeleteObjects(&s3.DeleteObjectsInput{
+				Bucket: &bucketName,
+				Delete: &s3.Delete{Objects: objects},
+			})
 			if err != nil {
 				return err
 			}
-			cnt = len(res.Contents)
+			for _, delErr := range delRes.Errors {
+				merr.Errors = append(merr.Errors, fmt.Errorf("%s: %s", aws.StringValue(delErr.Key), aws.StringValue(delErr.Message)))
+			}
 		}
-		return nil
+		if page.IsTruncated == nil || *page.IsTruncated == false {
+			break
+		}
+		listParams.ContinuationToken = page.NextContinuationToken
 	}
-	return fmt.Errorf("s3Service not configured")
+	if len(merr.Errors) > 0 {
+		return merr
+	}
+	return nil
 }
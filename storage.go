@@ -1,4 +1,3 @@
-//
 // storage package wraps both local disc and S3 storage with CRUD operations and common os.*, ioutil.* functions.
 //
 // @author R. S. Doiel, <rsdoiel@library.caltech.edu>
@@ -15,15 +14,16 @@
 // 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
 //
 // THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
-//
 package storage
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path"
 	"strings"
+	"time"
 )
 
 const (
@@ -34,6 +34,23 @@ const (
 	UNSUPPORTED = iota
 	// FS local file system
 	FS
+	// GO_CDK wraps gocloud.dev/blob giving us s3://, gs://, azblob://, mem:// and file:// support
+	// through a single Store API.
+	GO_CDK
+	// S3 configures a Store directly against the AWS SDK (see s3.go), for
+	// callers that need S3-specific functionality GO_CDK's blob.Bucket
+	// abstraction doesn't expose. s3.go already set store.Type = S3 before
+	// this constant existed, which left it undefined; declared here so
+	// Init can actually dispatch to it.
+	S3
+	// GS configures a Store directly against the Google Cloud Storage
+	// client library (see gs.go), for the same reason S3 exists alongside
+	// GO_CDK.
+	GS
+	// AZURE configures a Store directly against the Azure Blob Storage
+	// SDK, for the same reason S3 and GS exist alongside GO_CDK. See
+	// azure.go.
+	AZURE
 	// Other constants will be create as other storage systems are implemented
 )
 
@@ -72,6 +89,149 @@ type Store struct {
 	// Extended operations for datatools and dataset
 	// Writefilter takes a final path and a processing function which accepts the temp pointer
 	WriteFilter func(string, func(*os.File) error) error
+
+	// Streaming operations, for callers that want to avoid buffering a
+	// whole object into memory the way Read/ReadFile/WriteFile do, or
+	// that want to hand a writer to an encoder (json.Encoder, tar.Writer,
+	// csv.Writer, ...).
+	Open      func(string) (io.ReadCloser, error)
+	OpenWrite func(string, os.FileMode) (io.WriteCloser, error)
+	// OpenRange opens an HTTP-Range-style partial read of length bytes
+	// starting at off.
+	OpenRange func(string, int64, int64) (io.ReadCloser, error)
+
+	// Context-aware counterparts of the operations above, for callers
+	// that need to cancel an in-flight PUT/GET on request timeout.
+	// The GO_CDK backend (see gocdk.go) honors ctx fully by threading it
+	// straight into the underlying SDK call; the FS backend honors it
+	// best effort, since os doesn't accept a context directly (see
+	// fs.go's ctxFile). On those backends the non-context operations
+	// above are wrappers that call these with context.Background(). The
+	// direct-SDK S3, GS and AZURE backends set only ReadDirContext and
+	// OpenWriteContext; their other Context fields are left nil and their
+	// non-context operations call the SDK directly.
+	CreateContext    func(context.Context, string, io.Reader) error
+	ReadContext      func(context.Context, string) ([]byte, error)
+	UpdateContext    func(context.Context, string, io.Reader) error
+	DeleteContext    func(context.Context, string) error
+	StatContext      func(context.Context, string) (os.FileInfo, error)
+	ReadDirContext   func(context.Context, string) ([]os.FileInfo, error)
+	ReadFileContext  func(context.Context, string) ([]byte, error)
+	WriteFileContext func(context.Context, string, []byte, os.FileMode) error
+
+	OpenContext      func(context.Context, string) (io.ReadCloser, error)
+	OpenWriteContext func(context.Context, string, os.FileMode) (io.WriteCloser, error)
+	OpenRangeContext func(context.Context, string, int64, int64) (io.ReadCloser, error)
+
+	// LocationFn, when set, overrides the default Type based behavior of
+	// Location. Wrappers like NewBasePath use this to adjust workPath
+	// before delegating instead of reimplementing Location's switch.
+	LocationFn func(string) (string, error)
+
+	// WalkDirFn, when set, overrides the default ReadDir-then-iterate
+	// behavior of WalkDir. Backends that can page a listing natively
+	// (see s3.go, gs.go) set this to stream entries to fn as pages
+	// arrive, instead of materializing the whole []os.FileInfo first.
+	WalkDirFn func(string, func(os.FileInfo) error) error
+
+	// Bucket lifecycle operations, for backends (s3.go, gs.go) backed by
+	// a provisioned bucket/container rather than a plain filesystem
+	// path. Left nil on backends with no such concept, e.g. FS.
+	BucketCreate func(string, BucketOptions) error
+	BucketDelete func(string) error
+	BucketExists func(string) (bool, error)
+
+	// SignedURL returns a time-limited URL granting method ("GET",
+	// "PUT", or "DELETE") access to fname without the caller's
+	// credentials, for direct-to-browser download/upload flows that
+	// shouldn't proxy bytes through this process. Left nil on backends
+	// with no such concept, e.g. FS.
+	SignedURL func(string, string, time.Duration) (string, error)
+
+	// ReadRange fetches length bytes of fname starting at offset,
+	// without downloading the whole object the way Read/ReadFile do.
+	// OpenReaderAt wraps the same underlying fetch in an io.ReaderAt,
+	// fetching fname's total size once up front (e.g. via Stat) so
+	// random-access callers like archive/zip.NewReader can seek
+	// without a Stat round trip per read. Left nil on backends with no
+	// such concept, e.g. FS.
+	ReadRange    func(string, int64, int64) ([]byte, error)
+	OpenReaderAt func(string) (ReaderAtCloser, int64, error)
+}
+
+// BucketOptions configures BucketCreate, covering the handful of
+// properties common to S3 and GCS buckets so callers don't need a
+// backend-specific options type to provision one.
+type BucketOptions struct {
+	// Region is the bucket's location, e.g. S3's LocationConstraint or
+	// GCS's bucket Location. Empty uses the service's default region.
+	Region string
+	// StorageClass, e.g. "STANDARD", "NEARLINE", "GLACIER".
+	StorageClass string
+	// Versioning enables object versioning on the bucket.
+	Versioning bool
+	// ReuseExisting, S3 only, treats a bucket the caller already owns
+	// as success instead of an error. GCS has no equivalent distinct
+	// error code to special-case.
+	ReuseExisting bool
+}
+
+// rangeReadCloser composes a limited Reader with an independent Closer,
+// for OpenRange implementations that open the full stream, skip to off,
+// then cap the read at length bytes.
+type rangeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// streamWriteFilter implements WriteFilter for any backend with a working
+// OpenWrite, without WriteFilter's *os.File-shaped processor signature
+// forcing a temp file onto disk: processor runs against the write end of
+// an os.Pipe, a goroutine copies the read end straight into OpenWrite,
+// and Close on the upload waits for both to finish. Backends that keep
+// their own WriteFilter (e.g. FS, where rename-on-close is cheaper) don't
+// call this, even where they implement OpenWrite.
+func streamWriteFilter(store *Store, finalPath string, processor func(*os.File) error) error {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	wr, err := store.OpenWrite(finalPath, 0664)
+	if err != nil {
+		pr.Close()
+		pw.Close()
+		return err
+	}
+
+	copyDone := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(wr, pr)
+		pr.Close()
+		copyDone <- err
+	}()
+
+	procErr := processor(pw)
+	pw.Close()
+	copyErr := <-copyDone
+
+	if procErr != nil {
+		wr.Close()
+		return procErr
+	}
+	if copyErr != nil {
+		wr.Close()
+		return copyErr
+	}
+	return wr.Close()
+}
+
+// ReaderAtCloser is what OpenReaderAt returns: an io.ReaderAt a caller
+// can hand to archive/zip.NewReader or similar random-access consumers,
+// plus a Close to release whatever connection backs it.
+type ReaderAtCloser interface {
+	io.ReaderAt
+	io.Closer
 }
 
 // Init returns a Store struct and error based on the provided
@@ -87,6 +247,14 @@ func Init(storeType int, options map[string]interface{}) (*Store, error) {
 	switch storeType {
 	case FS:
 		return fsConfigure(store)
+	case GO_CDK:
+		return cdkConfigure(store)
+	case S3:
+		return s3Configure(store)
+	case GS:
+		return gsConfigure(store)
+	case AZURE:
+		return azureConfigure(store)
 	default:
 		return store, fmt.Errorf("storeType not supported")
 	}
@@ -98,6 +266,14 @@ func Init(storeType int, options map[string]interface{}) (*Store, error) {
 func StorageType(p string) int {
 	s := strings.ToLower(p)
 	switch {
+	case strings.HasPrefix(s, "s3://"),
+		strings.HasPrefix(s, "gs://"),
+		strings.HasPrefix(s, "azblob://"),
+		strings.HasPrefix(s, "mem://"),
+		strings.HasPrefix(s, "file://"):
+		// These schemes are handled by the Go Cloud Development Kit's
+		// blob package, see gocdk.go.
+		return GO_CDK
 	case strings.Contains(s, "://"):
 		return UNSUPPORTED
 	}
@@ -118,16 +294,39 @@ func GetDefaultStore() (*Store, error) {
 	return store, err
 }
 
+// schemeOf returns the URL scheme portion of name, or "fs" if name has
+// no "scheme://" prefix.
+func schemeOf(name string) string {
+	if i := strings.Index(name, "://"); i >= 0 {
+		return strings.ToLower(name[:i])
+	}
+	return "fs"
+}
+
 // GetStore creates a new Store struct based on the path provided. Unlike
 // Init it derives the storage type from the path provided and populated options
 // based on that path.
 //
 // Returns a new Store struct and error
 func GetStore(name string) (*Store, error) {
+	opts := make(map[string]interface{})
+
+	// Prefer a backend registered for this scheme (see Register) so
+	// third party backends don't require editing this switch.
+	if factory, ok := lookupBackend(schemeOf(name)); ok == true {
+		store := new(Store)
+		store.Config = opts
+		backend, err := factory(opts)
+		if err != nil {
+			return nil, err
+		}
+		store.Type = FS
+		return backendConfigure(store, backend)
+	}
+
 	// Get store type
 	sType := StorageType(name)
 
-	opts := make(map[string]interface{})
 	// Init the store based on storage type detected.
 	store, err := Init(sType, opts)
 	if err != nil {
@@ -188,6 +387,9 @@ func (store *Store) IsDir(p string) bool {
 
 // Location returns either a working path (disc) or URI (cloud/object store)
 func (store *Store) Location(workPath string) (string, error) {
+	if store.LocationFn != nil {
+		return store.LocationFn(workPath)
+	}
 	switch store.Type {
 	case FS:
 		return workPath, nil
@@ -195,3 +397,38 @@ func (store *Store) Location(workPath string) (string, error) {
 		return "", fmt.Errorf("storeType not supported")
 	}
 }
+
+// WalkDir calls fn once per entry under prefix, stopping and returning
+// fn's error as soon as it returns one. Use this instead of ReadDir when
+// a listing may hold more entries than should be materialized into a
+// single []os.FileInfo at once.
+func (store *Store) WalkDir(prefix string, fn func(os.FileInfo) error) error {
+	if store.WalkDirFn != nil {
+		return store.WalkDirFn(prefix, fn)
+	}
+	entries, err := store.ReadDir(prefix)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MultiError aggregates the errors from a batch operation (e.g. the
+// per-key failures reported by an S3 DeleteObjects call) so callers see
+// all of them instead of only the first.
+type MultiError struct {
+	Errors []error
+}
+
+func (m *MultiError) Error() string {
+	msgs := make([]string, len(m.Errors))
+	for i, err := range m.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
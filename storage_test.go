@@ -227,15 +227,18 @@ func TestReadDir(t *testing.T) {
 // Check to make sure StorageType is detectable from provided paths
 func TestStorageType(t *testing.T) {
 	m := map[string]int{
-		"/my/stuff":              FS,
-		"stuff":                  FS,
-		"foo.txt":                FS,
-		"s3://example.edu/stuff": UNSUPPORTED,
-		"gs://example.edu/stuff": UNSUPPORTED,
-		"eworiwer://example.io/": UNSUPPORTED,
-		"https://example.io":     UNSUPPORTED,
-		"http://erwerew":         UNSUPPORTED,
-		"gopher://ewreweww":      UNSUPPORTED,
+		"/my/stuff":                FS,
+		"stuff":                    FS,
+		"foo.txt":                  FS,
+		"s3://example.edu/stuff":   GO_CDK,
+		"gs://example.edu/stuff":   GO_CDK,
+		"azblob://example.edu/box": GO_CDK,
+		"mem://stuff":              GO_CDK,
+		"file:///tmp/stuff":        GO_CDK,
+		"eworiwer://example.io/":   UNSUPPORTED,
+		"https://example.io":       UNSUPPORTED,
+		"http://erwerew":           UNSUPPORTED,
+		"gopher://ewreweww":        UNSUPPORTED,
 	}
 	for p, expected := range m {
 		if r := StorageType(p); r != expected {